@@ -0,0 +1,66 @@
+// cmd/cli/changelog.go
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"buildy/pkg/changelog"
+	"buildy/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	changelogRange changelog.Range
+	changelogFile  string
+	notes          bool
+	notesFormat    string
+	changelogCmd   = &cobra.Command{
+		Use:   "changelog",
+		Short: "Preview the changelog entry or release notes of a version or commit range without updating any changelog",
+		Args:  cobra.NoArgs,
+		Run:   runChangelog,
+	}
+)
+
+func init() {
+	changelogCmd.Flags().StringVar(&changelogRange.Project, "project", "", "Subproject to generate the entry for (default: the central project)")
+	changelogCmd.Flags().StringVar(&changelogRange.Version, "version", "", "Regenerate the entry of a released version (X.Y.Z), or name the entry of a --from/--to range")
+	changelogCmd.Flags().StringVar(&changelogRange.From, "from", "", "Tag, branch or commit the range starts after (default: the last changelog checkpoint)")
+	changelogCmd.Flags().StringVar(&changelogRange.To, "to", "", "Tag, branch or commit the range ends at (default: HEAD)")
+	changelogCmd.Flags().StringVarP(&changelogFile, "file", "f", "", "Write the entry to this file instead of stdout")
+	changelogCmd.Flags().BoolVar(&notes, "notes", false, "Render release notes, with links to commits and issues and a list of contributors, instead of the changelog entry")
+	changelogCmd.Flags().StringVar(&notesFormat, "format", changelog.NotesMarkdown, "Release notes format: markdown or json (implies --notes)")
+	rootCmd.AddCommand(changelogCmd)
+}
+
+func runChangelog(cmd *cobra.Command, args []string) {
+	cfg, err := config.ParseConfig(configFile, profile)
+	if err != nil {
+		logger.Error.Printf("Error parsing configuration file: %v\n", err)
+		os.Exit(1)
+	}
+
+	var entry string
+	if notes || cmd.Flags().Changed("format") {
+		entry, err = changelog.ReleaseNotes(cfg, outputDir, changelogRange, notesFormat)
+	} else {
+		entry, err = changelog.Preview(cfg, outputDir, changelogRange)
+	}
+	if err != nil {
+		logger.Error.Printf("Error generating changelog: %v\n", err)
+		os.Exit(1)
+	}
+
+	if changelogFile == "" {
+		fmt.Print(entry)
+		return
+	}
+	err = ioutil.WriteFile(changelogFile, []byte(entry), 0644)
+	if err != nil {
+		logger.Error.Printf("Error writing changelog file: %v\n", err)
+		os.Exit(1)
+	}
+	logger.Info.Printf("Changelog written to %s\n", changelogFile)
+}
@@ -0,0 +1,71 @@
+// cmd/cli/history.go
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"buildy/pkg/history"
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyLast      int
+	historyThreshold float64
+	historyCmd       = &cobra.Command{
+		Use:   "history",
+		Short: "Show pass/fail trends, flaky subprojects and duration regressions over recent builds",
+		Args:  cobra.NoArgs,
+		Run:   runHistory,
+	}
+)
+
+func init() {
+	historyCmd.Flags().IntVarP(&historyLast, "last", "n", 20, "Number of recent builds to analyze (0 for all)")
+	historyCmd.Flags().Float64Var(&historyThreshold, "threshold", 0.5, "Report a duration regression when the latest build is this fraction slower than the median")
+	rootCmd.AddCommand(historyCmd)
+}
+
+func runHistory(cmd *cobra.Command, args []string) {
+	reports, err := history.Load(outputDir, historyLast)
+	if err != nil {
+		logger.Error.Printf("Error loading build history: %v\n", err)
+		os.Exit(1)
+	}
+	if len(reports) == 0 {
+		logger.Info.Printf("No build history in %s\n", outputDir)
+		return
+	}
+
+	first, last := reports[0].Timestamp, reports[len(reports)-1].Timestamp
+	fmt.Printf("Last %d builds (%s to %s), oldest first\n\n", len(reports), first.Format("2006-01-02 15:04"), last.Format("2006-01-02 15:04"))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SUBPROJECT\tTREND\tPASS RATE\tFLAKY\tLATEST PASS\tMEDIAN\tREGRESSION")
+	for _, trend := range history.Analyze(reports, historyThreshold) {
+		passRate := "-"
+		if trend.Runs > 0 {
+			passRate = fmt.Sprintf("%.0f%% (%d/%d)", trend.PassRate()*100, trend.Passes, trend.Runs)
+		}
+		flaky := "no"
+		if trend.Flaky {
+			flaky = fmt.Sprintf("yes (%d flips, %d retried)", trend.Flips, trend.Retried)
+		}
+		latest, median, regression := "-", "-", "no"
+		if trend.LatestPassingDuration > 0 {
+			latest = trend.LatestPassingDuration.Round(time.Millisecond).String()
+		}
+		if trend.MedianDuration > 0 {
+			median = trend.MedianDuration.Round(time.Millisecond).String()
+		}
+		if trend.Regression {
+			regression = fmt.Sprintf("yes (+%.0f%%)", (float64(trend.LatestPassingDuration)/float64(trend.MedianDuration)-1)*100)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", trend.Name, trend.Statuses, passRate, flaky, latest, median, regression)
+	}
+	w.Flush()
+
+	fmt.Println("\nTrend: P passed, F failed, C cached, - did not run")
+}
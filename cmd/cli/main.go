@@ -2,11 +2,23 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"buildy/pkg/build"
+	"buildy/pkg/cache"
 	"buildy/pkg/config"
+	"buildy/pkg/history"
 	"buildy/pkg/logging"
+	"buildy/pkg/progress"
 	"buildy/pkg/reporting"
 	"buildy/pkg/changelog"
 	"buildy/pkg/versioning"
@@ -14,13 +26,26 @@ import (
 )
 
 var (
-	configFile string
-	outputDir  string
-	logger     *logging.Logger
-	rootCmd    = &cobra.Command{
-		Use:   "build-automation-tool",
-		Short: "A tool for automating builds, versioning, changelog, and tagging",
-		Run:   runBuild,
+	configFile    string
+	outputDir     string
+	profile       string
+	cacheDir      string
+	cacheURL      string
+	noCache       bool
+	sandbox       bool
+	reportFormats []string
+	logDir        string
+	logLevel      string
+	logFormat     string
+	jobs          int
+	progressMode  string
+	runID         string
+	logger        *logging.Logger
+	rootCmd       = &cobra.Command{
+		Use:               "build-automation-tool",
+		Short:             "A tool for automating builds, versioning, changelog, and tagging",
+		PersistentPreRunE: setupLogger,
+		Run:               runBuild,
 	}
 )
 
@@ -28,6 +53,17 @@ func init() {
 	logger = logging.NewDefaultLogger()
 	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "build-config.yaml", "Path to the configuration file")
 	rootCmd.PersistentFlags().StringVarP(&outputDir, "output", "o", "reports", "Output directory for build reports")
+	rootCmd.Flags().StringVar(&cacheDir, "cache-dir", ".buildy-cache", "Local build cache directory")
+	rootCmd.Flags().StringVar(&cacheURL, "cache-url", "", "Build cache shared between agents: an http(s) URL (GET/PUT <url>/<key>) or a shared directory")
+	rootCmd.Flags().BoolVar(&noCache, "no-cache", false, "Rebuild every subproject even if its inputs are unchanged")
+	rootCmd.Flags().BoolVar(&sandbox, "sandbox", false, "Build every subproject in a hermetic sandbox")
+	rootCmd.Flags().IntVarP(&jobs, "jobs", "j", 1, "Number of subprojects to build in parallel")
+	rootCmd.Flags().StringVar(&progressMode, "progress", "auto", "Progress display: tty for live status lines, plain for log lines, or auto to use tty on a terminal")
+	rootCmd.Flags().StringVar(&logDir, "log-dir", "logs", "Directory for the output of each build, written to <log-dir>/<run-id>/<subproject>.log")
+	rootCmd.Flags().StringSliceVar(&reportFormats, "report-format", []string{"text"}, "Build report formats to write: "+strings.Join(reporting.Formats(), ", "))
+	rootCmd.PersistentFlags().StringVarP(&profile, "profile", "p", "", "Named config profile to apply (e.g. dev, staging, prod)")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Minimum level of log messages: debug, info, warn or error")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", logging.FormatText, "Log message format: text or json")
 }
 
 func main() {
@@ -37,37 +73,135 @@ func main() {
 	}
 }
 
+func setupLogger(cmd *cobra.Command, args []string) error {
+	level, err := logging.ParseLevel(logLevel)
+	if err != nil {
+		return err
+	}
+	logger.SetLevel(level)
+	return logger.SetFormat(logFormat)
+}
+
 func runBuild(cmd *cobra.Command, args []string) {
+	if err := reporting.ValidateFormats(reportFormats); err != nil {
+		logger.Error.Println(err)
+		os.Exit(1)
+	}
+
 	// Parse the configuration file
-	cfg, err := config.ParseConfig(configFile)
+	cfg, err := config.ParseConfig(configFile, profile)
 	if err != nil {
 		logger.Error.Printf("Error parsing configuration file: %v\n", err)
 		os.Exit(1)
 	}
+	if err := changelog.ValidateFormats(cfg.Changelog.Formats); err != nil {
+		logger.Error.Println(err)
+		os.Exit(1)
+	}
+
+	// Cancel running builds on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Run the build process
-	buildResults := build.RunBuild(cfg, logger)
+	runID = newRunID()
+	buildOpts := build.Options{OutputDir: outputDir, Sandbox: sandbox}
+	if logDir != "" {
+		buildOpts.LogDir = filepath.Join(logDir, runID)
+	}
+	if !noCache {
+		buildOpts.Cache, err = openCache()
+		if err != nil {
+			logger.Error.Printf("Error opening build cache: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	buildOpts.Jobs = jobs
+
+	// Only projects with commits since their last changelog entry get a new
+	// version, and only one their changelog has no entry for yet. It is
+	// decided before building so that artifacts are collected under the
+	// version they are released as.
+	changes, err := changelog.PendingChanges(cfg, outputDir)
+	if err != nil {
+		logger.Error.Printf("Error checking for new commits: %v\n", err)
+		os.Exit(1)
+	}
+	buildOpts.ReleaseVersions = make(map[string]string)
+	for _, subProject := range cfg.SubProjects {
+		if changes.SubProjects[subProject.Name] == 0 {
+			continue
+		}
 
+		versionIncrement := "patch"
+		newVersion := versioning.IncrementVersion(subProject.Version, versionIncrement)
+		exists, err := changelog.HasEntry(cfg, outputDir, subProject.Name, newVersion)
+		if err != nil {
+			logger.Error.Printf("Error reading changelog of subproject %s: %v\n", subProject.Name, err)
+			os.Exit(1)
+		}
+		if exists {
+			logger.Warn.Printf("Subproject %s changelog already has an entry for %s, keeping version %s\n", subProject.Name, newVersion, subProject.Version)
+			continue
+		}
+		buildOpts.ReleaseVersions[subProject.Name] = newVersion
+	}
+
+	closeProgress, err := setupProgress(&buildOpts, len(cfg.SubProjects))
+	if err != nil {
+		logger.Error.Println(err)
+		os.Exit(1)
+	}
+	buildResults := build.RunBuild(ctx, cfg, buildOpts, logger.With("run_id", runID))
+	closeProgress()
+
+	// An interrupted build only records what happened, without versioning or changelogs
+	if ctx.Err() != nil {
+		logger.Warn.Println("Build cancelled")
+		saveReport(cfg, buildResults, nil)
+		os.Exit(1)
+	}
+
+	released := make(map[string]string)
 	for i, subProject := range cfg.SubProjects {
-		if buildResults[subProject.Name] == nil {
-
-			versionIncrement := "patch"
-			
-			// Increment the version if the build was successful
-			newVersion := versioning.IncrementVersion(subProject.Version, versionIncrement)
-			cfg.SubProjects[i].Version = newVersion
-			logger.Info.Printf("Subproject %s version updated to %s\n", subProject.Name, newVersion)
+		if buildResults[subProject.Name].Status != build.StatusSuccess {
+			continue
 		}
+		newVersion, ok := buildOpts.ReleaseVersions[subProject.Name]
+		if !ok {
+			if changes.SubProjects[subProject.Name] == 0 {
+				logger.Info.Printf("Subproject %s has no new commits, keeping version %s\n", subProject.Name, subProject.Version)
+			}
+			continue
+		}
+
+		// Increment the version if the build was successful
+		cfg.SubProjects[i].Version = newVersion
+		released[subProject.Name] = subProject.Version
+		logger.Info.Printf("Subproject %s version updated to %s\n", subProject.Name, newVersion)
 	}
 
 	//Increment central version
-	newCentralVersion := versioning.IncrementVersion(cfg.Version, "patch")
-	cfg.Version = newCentralVersion
-	logger.Info.Printf("Central Project %s version updated to %s\n", cfg.Name, newCentralVersion)
+	if len(released) > 0 || changes.Central > 0 {
+		newCentralVersion := versioning.IncrementVersion(cfg.Version, "patch")
+		exists, err := changelog.HasEntry(cfg, outputDir, "", newCentralVersion)
+		if err != nil {
+			logger.Error.Printf("Error reading centralized changelog: %v\n", err)
+			os.Exit(1)
+		}
+		if exists {
+			logger.Warn.Printf("Centralized changelog already has an entry for %s, keeping version %s\n", newCentralVersion, cfg.Version)
+		} else {
+			cfg.Version = newCentralVersion
+			logger.Info.Printf("Central Project %s version updated to %s\n", cfg.Name, newCentralVersion)
+		}
+	} else {
+		logger.Info.Printf("Central Project %s has no new commits, keeping version %s\n", cfg.Name, cfg.Version)
+	}
 
 
 	// Generate the changelog
-	err = changelog.GenerateChangelogs(cfg, outputDir)
+	changelogs, err := changelog.GenerateChangelogs(cfg, outputDir, released)
 	if err != nil {
 		logger.Error.Printf("Error generating changelog: %v\n", err)
 		os.Exit(1)
@@ -81,19 +215,102 @@ func runBuild(cmd *cobra.Command, args []string) {
 	}
 
 	// Generate and save the build report
-	report, err := reporting.GenerateBuildReport(cfg, buildResults)
+	saveReport(cfg, buildResults, changelogs)
+
+	// Subprojects that didn't build fail the run, once the others are released
+	var failedProjects []string
+	for _, subProject := range cfg.SubProjects {
+		if result := buildResults[subProject.Name]; result == nil || !result.Succeeded() {
+			status := "not built"
+			if result != nil {
+				status = result.Status
+			}
+			failedProjects = append(failedProjects, fmt.Sprintf("%s (%s)", subProject.Name, status))
+		}
+	}
+	if len(failedProjects) > 0 {
+		logger.Error.Printf("Build failed: %s\n", strings.Join(failedProjects, ", "))
+		os.Exit(1)
+	}
+
+	logger.Info.Println("Build completed successfully")
+}
+
+// setupProgress picks how build progress and command output are shown and
+// returns a function to call once the build is done
+func setupProgress(opts *build.Options, total int) (func(), error) {
+	tty := false
+	switch progressMode {
+	case "auto":
+		tty = progress.IsTerminal(os.Stdout) && logFormat != logging.FormatJSON
+	case "tty":
+		tty = true
+	case "plain":
+	default:
+		return nil, fmt.Errorf("unknown progress display %q (expected auto, tty or plain)", progressMode)
+	}
+
+	if tty {
+		display := progress.NewDisplay(os.Stdout, total)
+		opts.Observer = display
+		logger.SetOutput(display.Log())
+		return func() {
+			display.Close()
+			logger.SetOutput(os.Stdout)
+		}, nil
+	}
+
+	// Output of parallel builds is prefixed line by line to keep it apart
+	if opts.Jobs > 1 {
+		opts.Observer = progress.NewPlain(os.Stdout)
+	}
+	return func() {}, nil
+}
+
+// newRunID names a build by its start time, to the millisecond, and a random
+// suffix so that builds started at the same moment don't share a log directory
+func newRunID() string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return time.Now().Format("20060102-150405.000") + "-" + hex.EncodeToString(suffix)
+}
+
+// openCache returns the local cache directory, backed by the shared cache
+// when --cache-url is set.
+func openCache() (cache.Store, error) {
+	local, err := cache.NewDirStore(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	if cacheURL == "" {
+		return local, nil
+	}
+	shared, err := cache.NewStore(cacheURL)
+	if err != nil {
+		return nil, err
+	}
+	return cache.MultiStore{local, shared}, nil
+}
+
+func saveReport(cfg *config.Config, buildResults map[string]*build.Result, changelogs map[string]string) {
+	report, err := reporting.GenerateBuildReport(cfg, buildResults, changelogs)
 	if err != nil {
 		logger.Error.Printf("Error generating build report: %v\n", err)
 		os.Exit(1)
 	}
+	report.RunID = runID
 
-	err = reporting.SaveBuildReport(report, outputDir)
+	err = reporting.SaveBuildReport(report, outputDir, reportFormats)
 	if err != nil {
 		logger.Error.Printf("Error saving build report: %v\n", err)
 		os.Exit(1)
 	}
 
-	logger.Info.Println("Build completed successfully")
+	// The history is only used for trends, so failing to record it doesn't fail the build
+	err = history.Append(outputDir, report)
+	if err != nil {
+		logger.Warn.Printf("Error recording build history: %v\n", err)
+	}
 }
 
 
@@ -105,6 +322,3 @@ func getSubProjectByName(subProjects []config.SubProject, name string) *config.S
 	}
 	return nil
 }
-
-
-// TODO: A mechanism to stop writing logs if no new commits, maybe increase the version or introduce a build number
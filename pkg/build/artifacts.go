@@ -0,0 +1,183 @@
+// pkg/build/artifacts.go
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"buildy/pkg/config"
+)
+
+type Artifact struct {
+	// Name is the artifact's slash-separated path relative to the subproject
+	Name string `json:"name"`
+	// Path is where the artifact was collected to, under the output directory
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// Mode holds the permission bits, so that executables stay executable
+	// when restored from the cache
+	Mode os.FileMode `json:"mode,omitempty"`
+}
+
+// artifactDir is where a subproject version's outputs are collected
+func artifactDir(outputDir, name, version string) string {
+	return filepath.Join(outputDir, "artifacts", name, version)
+}
+
+// collectArtifacts copies the files matching the subproject's outputs globs
+// from root into destDir, keeping their paths relative to root, and writes
+// a SHA256SUMS file next to them. Every glob must match.
+func collectArtifacts(root string, subProject config.SubProject, destDir string) ([]Artifact, error) {
+	files, err := matchOutputs(root, subProject.Outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.RemoveAll(destDir)
+	if err != nil {
+		return nil, fmt.Errorf("error clearing artifact directory: %v", err)
+	}
+
+	var artifacts []Artifact
+	for _, file := range files {
+		artifact, err := copyArtifact(filepath.Join(root, filepath.FromSlash(file)), destDir, file)
+		if err != nil {
+			return nil, fmt.Errorf("error collecting artifact %s: %v", file, err)
+		}
+		artifacts = append(artifacts, artifact)
+	}
+
+	return artifacts, writeChecksums(destDir, artifacts)
+}
+
+// copyArtifact copies the file at src to name under destDir, keeping its mode
+func copyArtifact(src, destDir, name string) (Artifact, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return Artifact{}, err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	return writeArtifact(in, destDir, name, info.Mode().Perm())
+}
+
+// writeArtifact writes content to name under destDir and returns the
+// resulting artifact with its size and sha256.
+func writeArtifact(content io.Reader, destDir, name string, mode os.FileMode) (Artifact, error) {
+	dest := filepath.Join(destDir, filepath.FromSlash(name))
+	err := os.MkdirAll(filepath.Dir(dest), os.ModePerm)
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return Artifact{}, err
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, hash), content)
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	artifact := Artifact{Name: name, Path: dest, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil)), Mode: mode}
+	return artifact, out.Close()
+}
+
+// writeChecksums writes a SHA256SUMS file listing the artifacts in destDir
+func writeChecksums(destDir string, artifacts []Artifact) error {
+	if len(artifacts) == 0 {
+		return nil
+	}
+
+	var sums strings.Builder
+	for _, artifact := range artifacts {
+		fmt.Fprintf(&sums, "%s  %s\n", artifact.SHA256, artifact.Name)
+	}
+
+	err := ioutil.WriteFile(filepath.Join(destDir, "SHA256SUMS"), []byte(sums.String()), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing checksums: %v", err)
+	}
+	return nil
+}
+
+// matchOutputs returns the files under root matching any of the globs, as
+// sorted slash-separated relative paths.
+func matchOutputs(root string, globs []string) ([]string, error) {
+	if len(globs) == 0 {
+		return nil, nil
+	}
+
+	files, err := walkFiles(root)
+	if err != nil {
+		return nil, fmt.Errorf("error listing outputs: %v", err)
+	}
+
+	matched := make(map[string]bool)
+	for _, glob := range globs {
+		found := false
+		for _, file := range files {
+			file = filepath.ToSlash(file)
+			if matchGlob(path.Clean(filepath.ToSlash(glob)), file) {
+				matched[file] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("output %q matched no files", glob)
+		}
+	}
+
+	result := make([]string, 0, len(matched))
+	for file := range matched {
+		result = append(result, file)
+	}
+	sort.Strings(result)
+
+	return result, nil
+}
+
+// matchGlob matches a slash-separated name against a pattern in which each
+// segment follows path.Match, and a "**" segment matches any number of
+// segments, including none.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
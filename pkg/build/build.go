@@ -2,23 +2,553 @@
 package build
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
 
+	"buildy/pkg/cache"
 	"buildy/pkg/config"
+	"buildy/pkg/graph"
 	"buildy/pkg/logging"
 )
 
-func RunBuild(cfg *config.Config, logger *logging.Logger) map[string]error {
-	buildResults := make(map[string]error)
+const (
+	StatusSuccess   = "Success"
+	StatusFailure   = "Failure"
+	StatusTimedOut  = "TimedOut"
+	StatusCancelled = "Cancelled"
+	StatusSkipped   = "Skipped"
+	StatusCached    = "Cached"
+)
+
+// Delay before the first retry of a failed command when retryBackoff isn't set
+const defaultRetryBackoff = time.Second
+
+type Options struct {
+	// OutputDir is exposed to build commands as BUILDY_OUTPUT_DIR
+	OutputDir string
+
+	// Cache stores successful builds by fingerprint. Caching is disabled
+	// when it is nil.
+	Cache cache.Store
+
+	// Sandbox runs every subproject in a sandbox, not only those that opt in
+	Sandbox bool
+
+	// Jobs is the number of subprojects built at the same time, at least 1
+	Jobs int
+
+	// Observer follows the build's progress and receives the output of
+	// build commands, which goes to stdout when it is nil
+	Observer Observer
+
+	// LogDir receives a <subproject>.log file with the output of each
+	// subproject's commands, which still go to stdout as well. Logging to
+	// files is disabled when it is empty.
+	LogDir string
+
+	// ReleaseVersions are the versions subprojects are released as when
+	// they build successfully, by name, and their artifacts collected under.
+	// Subprojects that aren't listed keep their current version.
+	ReleaseVersions map[string]string
+}
+
+// releaseVersion is the version subProject is released as if it builds
+func (o Options) releaseVersion(subProject config.SubProject) string {
+	if version, ok := o.ReleaseVersions[subProject.Name]; ok {
+		return version
+	}
+	return subProject.Version
+}
+
+type Result struct {
+	// Version is the version the subproject was built as, which it is
+	// released as if the build succeeds, and PreviousVersion the version it
+	// had before when that is different
+	Version         string
+	PreviousVersion string
+	Status          string
+	Err             error
+	Steps           []StepResult
+
+	StartTime time.Time
+	EndTime   time.Time
+	Duration  time.Duration
+	// CPUTime and MaxRSS (in bytes) sum up and peak over all step commands
+	CPUTime time.Duration
+	MaxRSS  int64
+
+	// Fingerprint of the subproject's inputs, empty when caching is disabled
+	Fingerprint string
+
+	Artifacts []Artifact
+
+	// LogFile holds the output of the subproject's commands, and LogTail
+	// its last lines when the build failed
+	LogFile string
+	LogTail string
+}
+
+// RunBuild builds the subprojects in dependency order, running up to
+// opts.Jobs of them at a time once their dependencies are done.
+func RunBuild(ctx context.Context, cfg *config.Config, opts Options, logger *logging.Logger) map[string]*Result {
+	buildResults := make(map[string]*Result)
+	fingerprints := newFingerprinter(cfg)
+	if opts.Observer == nil {
+		opts.Observer = stdoutObserver{}
+	}
+
+	order, err := graph.TopologicalOrder(cfg.SubProjects)
+	if err != nil {
+		logger.Error.Printf("Cannot order subprojects: %v\n", err)
+		for _, subProject := range cfg.SubProjects {
+			buildResults[subProject.Name] = &Result{Status: StatusFailure, Err: err}
+			opts.Observer.SubProjectFinished(subProject.Name, buildResults[subProject.Name])
+		}
+		return buildResults
+	}
+	logger.Debug.Printf("Build order: %s\n", strings.Join(order, ", "))
+
+	jobs := opts.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	type finished struct {
+		name   string
+		result *Result
+	}
+	done := make(chan finished)
+	pending := order
+	running := 0
+
+	for len(pending) > 0 || running > 0 {
+		// Start the first pending subprojects whose dependencies are done.
+		// Those that don't need building are resolved on the spot, which may
+		// unblock others, so look again until nothing more can start.
+		for started := true; started && running < jobs; {
+			started = false
+			for i, name := range pending {
+				subProject := *cfg.GetSubProject(name)
+				if !dependenciesDone(subProject, buildResults) {
+					continue
+				}
+				pending = append(pending[:i:i], pending[i+1:]...)
+				started = true
+
+				logger := logger.With("subproject", name)
+				result, fingerprint := resolveWithoutBuilding(ctx, subProject, opts, fingerprints, buildResults, logger)
+				if result != nil {
+					buildResults[name] = result
+					opts.Observer.SubProjectFinished(name, result)
+					break
+				}
 
-	for _, subProject := range cfg.SubProjects {
-		logger.Info.Printf("Building subproject: %s\n", subProject.Name)
+				// Builds only see the results of their own dependencies
+				dependencies := make(map[string]*Result, len(subProject.DependsOn))
+				for _, dependency := range subProject.DependsOn {
+					dependencies[dependency] = buildResults[dependency]
+				}
 
-		// TODO: Implement actual build steps for each subproject
-		// For now, we'll just simulate a successful build
-		buildResults[subProject.Name] = nil
+				running++
+				go func() {
+					result := buildAndRecord(ctx, cfg, subProject, opts, dependencies, fingerprint, logger)
+					done <- finished{subProject.Name, result}
+				}()
+				break
+			}
+		}
 
-		logger.Info.Printf("Subproject %s built successfully\n", subProject.Name)
+		if running == 0 {
+			break
+		}
+		f := <-done
+		running--
+		buildResults[f.name] = f.result
+		opts.Observer.SubProjectFinished(f.name, f.result)
 	}
 
 	return buildResults
-}
\ No newline at end of file
+}
+
+func dependenciesDone(subProject config.SubProject, buildResults map[string]*Result) bool {
+	for _, dependency := range subProject.DependsOn {
+		if _, ok := buildResults[dependency]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveWithoutBuilding returns the result of a subproject that doesn't
+// need building because the build was cancelled, a dependency failed or it
+// is in the cache, or nil and its fingerprint (when caching) to build it.
+func resolveWithoutBuilding(ctx context.Context, subProject config.SubProject, opts Options, fingerprints *fingerprinter, buildResults map[string]*Result, logger *logging.Logger) (*Result, string) {
+	if ctx.Err() != nil {
+		return &Result{Status: StatusCancelled, Err: errors.New("build cancelled before start")}, ""
+	}
+
+	if dependency := failedDependency(subProject, buildResults); dependency != "" {
+		err := fmt.Errorf("dependency %s %s", dependency, buildResults[dependency].Status)
+		logger.Warn.Printf("Skipping subproject %s: %v\n", subProject.Name, err)
+		return &Result{Status: StatusSkipped, Err: err}, ""
+	}
+
+	if opts.Cache == nil {
+		return nil, ""
+	}
+	fingerprint, err := fingerprints.fingerprint(subProject.Name)
+	if err != nil {
+		logger.Warn.Printf("Cannot fingerprint subproject %s, building without cache: %v\n", subProject.Name, err)
+		return nil, ""
+	}
+	return restoreFromCache(opts, subProject, fingerprint, logger), fingerprint
+}
+
+// buildAndRecord builds a subproject, logging its output to a file when
+// opts.LogDir is set, and records successful builds in the cache.
+func buildAndRecord(ctx context.Context, cfg *config.Config, subProject config.SubProject, opts Options, dependencies map[string]*Result, fingerprint string, logger *logging.Logger) *Result {
+	logger.Info.Printf("Building subproject: %s\n", subProject.Name)
+	opts.Observer.SubProjectStarted(subProject.Name)
+
+	output, log := opts.Observer.Output(subProject.Name), io.Discard
+	var logFile *os.File
+	if opts.LogDir != "" {
+		var err error
+		logFile, err = openLog(opts.LogDir, subProject.Name)
+		if err != nil {
+			logger.Warn.Printf("Cannot log output of subproject %s: %v\n", subProject.Name, err)
+		} else {
+			output, log = io.MultiWriter(output, logFile), logFile
+			fmt.Fprintf(log, "==> Building %s %s\n", subProject.Name, opts.releaseVersion(subProject))
+		}
+	}
+
+	start := time.Now()
+	result := buildSubProject(ctx, cfg, subProject, opts, dependencies, output, log, logger)
+	result.StartTime, result.EndTime = start, time.Now()
+	result.Duration = result.EndTime.Sub(start)
+	for _, step := range result.Steps {
+		result.CPUTime += step.CPUTime
+		if step.MaxRSS > result.MaxRSS {
+			result.MaxRSS = step.MaxRSS
+		}
+	}
+	result.Version = opts.releaseVersion(subProject)
+	if result.Version != subProject.Version {
+		result.PreviousVersion = subProject.Version
+	}
+	result.Fingerprint = fingerprint
+
+	if logFile != nil {
+		if result.Err != nil {
+			fmt.Fprintf(log, "==> %s: %v\n", result.Status, result.Err)
+		} else {
+			fmt.Fprintf(log, "==> %s in %s\n", result.Status, result.Duration.Round(time.Millisecond))
+		}
+		logFile.Close()
+
+		result.LogFile = logFile.Name()
+		if result.Err != nil {
+			var err error
+			result.LogTail, err = logTail(result.LogFile, logTailLines)
+			if err != nil {
+				logger.Warn.Printf("Cannot read log of subproject %s: %v\n", subProject.Name, err)
+			}
+		}
+	}
+	if result.Err != nil {
+		logger.Error.Printf("Subproject %s %s: %v\n", subProject.Name, result.Status, result.Err)
+		return result
+	}
+
+	if fingerprint != "" {
+		entry := cacheEntry{
+			Fingerprint: fingerprint,
+			Project:     subProject.Name,
+			Version:     opts.releaseVersion(subProject),
+			BuiltAt:     time.Now(),
+			Artifacts:   result.Artifacts,
+		}
+		if err := saveCacheEntry(opts.Cache, entry); err != nil {
+			logger.Warn.Printf("Cannot record build cache for subproject %s: %v\n", subProject.Name, err)
+		}
+	}
+
+	logger.Info.Printf("Subproject %s built successfully\n", subProject.Name)
+	return result
+}
+
+// Succeeded reports whether the subproject was built or found in the cache
+func (r *Result) Succeeded() bool {
+	return r.Status == StatusSuccess || r.Status == StatusCached
+}
+
+// failedDependency returns the first dependency that didn't build, if any
+func failedDependency(subProject config.SubProject, buildResults map[string]*Result) string {
+	for _, dependency := range subProject.DependsOn {
+		if !buildResults[dependency].Succeeded() {
+			return dependency
+		}
+	}
+	return ""
+}
+
+// restoreFromCache returns a Cached result if a build with this fingerprint
+// is in the cache and its artifacts could be restored, or nil to build.
+func restoreFromCache(opts Options, subProject config.SubProject, fingerprint string, logger *logging.Logger) *Result {
+	logger.Debug.Printf("Looking up fingerprint %s of subproject %s in the build cache\n", fingerprint, subProject.Name)
+	entry, err := loadCacheEntry(opts.Cache, fingerprint)
+	if err != nil {
+		logger.Warn.Printf("Cannot read build cache for subproject %s: %v\n", subProject.Name, err)
+		return nil
+	}
+	if entry == nil {
+		return nil
+	}
+
+	// Cached builds aren't released again, so their artifacts belong to the
+	// current version
+	artifacts, err := restoreArtifacts(opts.Cache, entry, artifactDir(opts.OutputDir, subProject.Name, subProject.Version))
+	if err != nil {
+		logger.Warn.Printf("Cannot restore cached artifacts of subproject %s, rebuilding: %v\n", subProject.Name, err)
+		return nil
+	}
+
+	logger.Info.Printf("Subproject %s is unchanged since a previous successful build (%s), skipping\n", subProject.Name, entry.Version)
+	return &Result{Version: subProject.Version, Status: StatusCached, Fingerprint: fingerprint, Artifacts: artifacts}
+}
+
+// buildSubProject runs a subproject's steps. Command output goes to output,
+// and notes on each step and attempt go to log.
+func buildSubProject(ctx context.Context, cfg *config.Config, subProject config.SubProject, opts Options, dependencies map[string]*Result, output, log io.Writer, logger *logging.Logger) *Result {
+	// Commands run in the subproject directory, or in a copy of its inputs
+	// and its dependencies' outputs when sandboxed
+	root := subProject.Path
+	baseEnv := processEnv()
+	if opts.Sandbox || subProject.Sandbox {
+		sb, err := newSandbox(subProject, dependencies)
+		if err != nil {
+			return failed(ctx, err)
+		}
+		defer sb.remove()
+
+		logger.Info.Printf("[%s] Building in sandbox %s\n", subProject.Name, sb.root)
+		root = sb.src()
+		baseEnv = sb.env()
+	}
+
+	workDir := filepath.Join(root, subProject.WorkDir)
+	if info, err := os.Stat(workDir); err != nil || !info.IsDir() {
+		return failed(ctx, fmt.Errorf("working directory %s does not exist", workDir))
+	}
+
+	env, err := buildEnv(subProject, baseEnv, opts)
+	if err != nil {
+		return failed(ctx, err)
+	}
+
+	steps, err := resolveSteps(subProject)
+	if err != nil {
+		return failed(ctx, err)
+	}
+
+	// Values `if` conditions can refer to
+	vars := map[string]string{
+		"branch":  headBranch(subProject.Path),
+		"profile": cfg.Profile,
+		"project": subProject.Name,
+	}
+
+	projectCtx := ctx
+	if subProject.Timeout > 0 {
+		var cancel context.CancelFunc
+		projectCtx, cancel = context.WithTimeout(ctx, subProject.Timeout)
+		defer cancel()
+	}
+
+	result := &Result{Status: StatusSuccess}
+	for _, step := range steps {
+		stepResult := StepResult{Name: step.Name, Phase: step.Phase, Command: step.Run, Status: StatusSkipped}
+
+		// Once a step has failed the remaining ones are only listed as skipped
+		if result.Err != nil {
+			result.Steps = append(result.Steps, stepResult)
+			continue
+		}
+
+		run, err := evaluateCondition(step.If, vars, env)
+		if err != nil {
+			stepResult.Status, stepResult.Err = StatusFailure, err
+			result.Steps = append(result.Steps, stepResult)
+			result.Status, result.Err = StatusFailure, fmt.Errorf("step %q: %w", step.Name, err)
+			continue
+		}
+		if !run {
+			logger.Info.Printf("[%s] Skipping step %s: condition %q not met\n", subProject.Name, step.Name, step.If)
+			fmt.Fprintf(log, "==> Skipping %s step %s: condition %q not met\n", step.Phase, step.Name, step.If)
+			result.Steps = append(result.Steps, stepResult)
+			continue
+		}
+
+		logger := logger.With("step", step.Name)
+		logger.Info.Printf("[%s] Running %s step %s\n", subProject.Name, step.Phase, step.Name)
+		opts.Observer.StepStarted(subProject.Name, step.Phase, step.Name)
+		fmt.Fprintf(log, "==> Running %s step %s: %s\n", step.Phase, step.Name, step.Run)
+
+		stepResult.StartTime = time.Now()
+		err = runWithRetries(projectCtx, subProject, step, workDir, envList(env, step.Env), output, log, &stepResult, logger)
+		stepResult.EndTime = time.Now()
+		stepResult.Duration = stepResult.EndTime.Sub(stepResult.StartTime)
+		if err == nil {
+			stepResult.Status = StatusSuccess
+			result.Steps = append(result.Steps, stepResult)
+			continue
+		}
+
+		if projectCtx.Err() != nil && ctx.Err() == nil {
+			err = fmt.Errorf("subproject timed out after %s: %w", subProject.Timeout, projectCtx.Err())
+		}
+		err = fmt.Errorf("step %q failed: %w", step.Name, err)
+		stepFailure := failed(ctx, err)
+		stepResult.Status, stepResult.Err = stepFailure.Status, err
+		result.Steps = append(result.Steps, stepResult)
+
+		if step.ContinueOnError && projectCtx.Err() == nil {
+			logger.Warn.Printf("[%s] %v (continuing)\n", subProject.Name, err)
+			continue
+		}
+		result.Status, result.Err = stepFailure.Status, err
+	}
+
+	if result.Err == nil && len(subProject.Outputs) > 0 {
+		destDir := artifactDir(opts.OutputDir, subProject.Name, opts.releaseVersion(subProject))
+		result.Artifacts, err = collectArtifacts(root, subProject, destDir)
+		if err != nil {
+			result.Status, result.Err = StatusFailure, err
+			return result
+		}
+		logger.Info.Printf("[%s] Collected %d artifacts into %s\n", subProject.Name, len(result.Artifacts), destDir)
+	}
+
+	return result
+}
+
+// runWithRetries runs a step, retrying up to step.Retries times with
+// exponential backoff, and records each attempt's resource usage in
+// stepResult. Cancellation of ctx is never retried.
+func runWithRetries(ctx context.Context, subProject config.SubProject, step config.Step, workDir string, env []string, output, log io.Writer, stepResult *StepResult, logger *logging.Logger) error {
+	backoff := subProject.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		cmd := shellCommand(step.Shell, step.Run)
+		logger.Debug.Printf("Running %q in %s\n", strings.Join(cmd.Args, " "), workDir)
+		err = runCommand(ctx, cmd, workDir, env, output, step.Timeout)
+		stepResult.recordAttempt(cmd.ProcessState)
+		if err == nil || ctx.Err() != nil || attempt >= *step.Retries {
+			return err
+		}
+
+		logger.Warn.Printf("[%s] Attempt %d/%d of step %s failed: %v; retrying in %s\n", subProject.Name, attempt+1, *step.Retries+1, step.Name, err, backoff)
+		fmt.Fprintf(log, "==> Attempt %d/%d failed: %v; retrying in %s\n", attempt+1, *step.Retries+1, err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// runCommand runs a command in its own process group, writing its stdout
+// and stderr to output. When ctx is done
+// or the timeout expires the whole group is terminated, then killed if it
+// hasn't exited after killGracePeriod.
+func runCommand(parent context.Context, cmd *exec.Cmd, workDir string, env []string, output io.Writer, timeout time.Duration) error {
+	ctx := parent
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(parent, timeout)
+		defer cancel()
+	}
+
+	cmd.Dir = workDir
+	cmd.Env = env
+	cmd.Stdout = output
+	cmd.Stderr = output
+	setProcessGroup(cmd)
+
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		terminateProcessGroup(cmd)
+		select {
+		case <-done:
+		case <-time.After(killGracePeriod):
+			killProcessGroup(cmd)
+			<-done
+		}
+		if parent.Err() == nil {
+			return fmt.Errorf("command timed out after %s: %w", timeout, ctx.Err())
+		}
+		return parent.Err()
+	}
+}
+
+// failed classifies err against the build-wide context: the build being
+// interrupted is Cancelled, any deadline hit along the way is TimedOut.
+func failed(ctx context.Context, err error) *Result {
+	switch {
+	case ctx.Err() != nil:
+		return &Result{Status: StatusCancelled, Err: err}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Result{Status: StatusTimedOut, Err: err}
+	default:
+		return &Result{Status: StatusFailure, Err: err}
+	}
+}
+
+// shellCommand runs command with the given shell, which defaults to sh (cmd
+// on Windows). The shell may include arguments, e.g. "bash -eo pipefail".
+func shellCommand(shell, command string) *exec.Cmd {
+	if strings.TrimSpace(shell) == "" {
+		shell = "sh"
+		if runtime.GOOS == "windows" {
+			shell = "cmd"
+		}
+	}
+
+	args := strings.Fields(shell)
+	switch filepath.Base(args[0]) {
+	case "cmd", "cmd.exe":
+		args = append(args, "/C")
+	case "pwsh", "powershell", "pwsh.exe", "powershell.exe":
+		args = append(args, "-Command")
+	default:
+		args = append(args, "-c")
+	}
+
+	return exec.Command(args[0], append(args[1:], command)...)
+}
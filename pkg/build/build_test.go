@@ -0,0 +1,240 @@
+// pkg/build/build_test.go
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"buildy/pkg/config"
+	"buildy/pkg/logging"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func runBuild(t *testing.T, cfg *config.Config, opts Options) map[string]*Result {
+	t.Helper()
+	return RunBuild(context.Background(), cfg, opts, logging.NewLogger(ioutil.Discard))
+}
+
+// eventObserver records when subprojects start and finish
+type eventObserver struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (o *eventObserver) record(event string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, event)
+}
+
+func (o *eventObserver) Output(string) io.Writer            { return ioutil.Discard }
+func (o *eventObserver) SubProjectStarted(name string)      { o.record("start " + name) }
+func (o *eventObserver) StepStarted(string, string, string) {}
+func (o *eventObserver) SubProjectFinished(name string, _ *Result) {
+	o.record("finish " + name)
+}
+
+func schedulerConfig(dir string, subProjects ...config.SubProject) *config.Config {
+	for i := range subProjects {
+		subProjects[i].Version = "1.0.0"
+		subProjects[i].Path = filepath.Join(dir, subProjects[i].Name)
+		os.MkdirAll(subProjects[i].Path, 0755)
+	}
+	return &config.Config{SubProjects: subProjects}
+}
+
+func TestRunBuildDependencyOrder(t *testing.T) {
+	dir := t.TempDir()
+	// Declared in reverse, and each build checks its dependency is done
+	cfg := schedulerConfig(dir,
+		config.SubProject{Name: "c", DependsOn: []string{"b"}, BuildCmd: []string{"test -f ../b/done && touch done"}},
+		config.SubProject{Name: "b", DependsOn: []string{"a"}, BuildCmd: []string{"test -f ../a/done && touch done"}},
+		config.SubProject{Name: "a", BuildCmd: []string{"sleep 0.2 && touch done"}},
+	)
+	observer := &eventObserver{}
+
+	results := runBuild(t, cfg, Options{Jobs: 3, Observer: observer})
+	for _, name := range []string{"a", "b", "c"} {
+		if results[name].Status != StatusSuccess {
+			t.Errorf("%s: %s: %v", name, results[name].Status, results[name].Err)
+		}
+	}
+	want := []string{"start a", "finish a", "start b", "finish b", "start c", "finish c"}
+	if !reflect.DeepEqual(observer.events, want) {
+		t.Errorf("events = %q, want %q", observer.events, want)
+	}
+}
+
+func TestRunBuildWaitsForDependencies(t *testing.T) {
+	dir := t.TempDir()
+	// b and c can build alongside each other once a is done, d only when
+	// both are
+	cfg := schedulerConfig(dir,
+		config.SubProject{Name: "a", BuildCmd: []string{"sleep 0.2 && touch done"}},
+		config.SubProject{Name: "b", DependsOn: []string{"a"}, BuildCmd: []string{"test -f ../a/done && sleep 0.3 && touch done"}},
+		config.SubProject{Name: "c", DependsOn: []string{"a"}, BuildCmd: []string{"test -f ../a/done && touch done"}},
+		config.SubProject{Name: "d", DependsOn: []string{"b", "c"}, BuildCmd: []string{"test -f ../b/done && test -f ../c/done"}},
+	)
+	observer := &eventObserver{}
+
+	results := runBuild(t, cfg, Options{Jobs: 2, Observer: observer})
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if results[name].Status != StatusSuccess {
+			t.Errorf("%s: %s: %v", name, results[name].Status, results[name].Err)
+		}
+	}
+	// b and c start in either order
+	events := observer.events
+	if len(events) > 3 {
+		sort.Strings(events[2:4])
+	}
+	want := []string{"start a", "finish a", "start b", "start c", "finish c", "finish b", "start d", "finish d"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %q, want %q", observer.events, want)
+	}
+}
+
+func TestRunBuildSkipsDependentsOfFailures(t *testing.T) {
+	dir := t.TempDir()
+	cfg := schedulerConfig(dir,
+		config.SubProject{Name: "a", BuildCmd: []string{"exit 1"}},
+		config.SubProject{Name: "b", DependsOn: []string{"a"}, BuildCmd: []string{"touch built"}},
+		config.SubProject{Name: "c", DependsOn: []string{"b"}, BuildCmd: []string{"touch built"}},
+		config.SubProject{Name: "d", BuildCmd: []string{"touch built"}},
+	)
+
+	results := runBuild(t, cfg, Options{Jobs: 2, Observer: &eventObserver{}})
+	want := map[string]string{"a": StatusFailure, "b": StatusSkipped, "c": StatusSkipped, "d": StatusSuccess}
+	for name, status := range want {
+		if results[name].Status != status {
+			t.Errorf("%s: %s (%v), want %s", name, results[name].Status, results[name].Err, status)
+		}
+		_, err := os.Stat(filepath.Join(dir, name, "built"))
+		if built := err == nil; built != (status == StatusSuccess) {
+			t.Errorf("%s built = %t, want %t", name, built, !built)
+		}
+	}
+	if err := results["b"].Err; err == nil || err.Error() != "dependency a Failure" {
+		t.Errorf("b: %v, want dependency a Failure", err)
+	}
+	if err := results["c"].Err; err == nil || err.Error() != "dependency b Skipped" {
+		t.Errorf("c: %v, want dependency b Skipped", err)
+	}
+}
+
+func TestRunBuildDependencyCycle(t *testing.T) {
+	dir := t.TempDir()
+	cfg := schedulerConfig(dir,
+		config.SubProject{Name: "a", DependsOn: []string{"b"}, BuildCmd: []string{"touch built"}},
+		config.SubProject{Name: "b", DependsOn: []string{"a"}, BuildCmd: []string{"touch built"}},
+	)
+
+	results := runBuild(t, cfg, Options{Observer: &eventObserver{}})
+	for _, name := range []string{"a", "b"} {
+		if results[name].Status != StatusFailure {
+			t.Errorf("%s: %s, want %s", name, results[name].Status, StatusFailure)
+		}
+	}
+}
+
+func TestSandboxedBuildReadsUntrackedEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a/main.go": "package main", "a/.env": "FROM_ENV_FILE=yes\n"})
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := worktree.Add("a/main.go"); err != nil {
+		t.Fatal(err)
+	}
+	cfg := schedulerConfig(dir, config.SubProject{
+		Name:     "a",
+		Sandbox:  true,
+		EnvFile:  ".env",
+		BuildCmd: []string{`test ! -e .env && test -f main.go && test "$FROM_ENV_FILE" = yes`},
+	})
+
+	if result := runBuild(t, cfg, Options{Observer: &eventObserver{}})["a"]; result.Status != StatusSuccess {
+		t.Errorf("build %s: %v", result.Status, result.Err)
+	}
+}
+
+func TestBuildReleaseVersion(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a/main.go": "package main"})
+	cfg := &config.Config{SubProjects: []config.SubProject{{
+		Name:     "a",
+		Version:  "1.0.0",
+		Path:     filepath.Join(dir, "a"),
+		BuildCmd: []string{`mkdir -p dist && printf %s "$BUILDY_VERSION" > dist/version.txt`},
+		Outputs:  []string{"dist/version.txt"},
+	}}}
+	opts := Options{
+		OutputDir:       filepath.Join(dir, "reports"),
+		LogDir:          filepath.Join(dir, "logs"),
+		ReleaseVersions: map[string]string{"a": "1.0.1"},
+	}
+
+	result := runBuild(t, cfg, opts)["a"]
+	if result.Status != StatusSuccess {
+		t.Fatalf("build %s: %v", result.Status, result.Err)
+	}
+	if result.Version != "1.0.1" || result.PreviousVersion != "1.0.0" {
+		t.Errorf("result version = %s (previously %s), want 1.0.1 (previously 1.0.0)", result.Version, result.PreviousVersion)
+	}
+
+	// The version the build command saw is the one its artifacts are
+	// collected under
+	stamped, err := ioutil.ReadFile(filepath.Join(artifactDir(opts.OutputDir, "a", "1.0.1"), "dist", "version.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(stamped) != "1.0.1" {
+		t.Errorf("BUILDY_VERSION = %q, want 1.0.1", stamped)
+	}
+
+	log, err := ioutil.ReadFile(result.LogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(log), "==> Building a 1.0.1\n") {
+		t.Errorf("log header:\n%s", log)
+	}
+}
+
+func TestFailed(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	timedOut := fmt.Errorf("step %q failed: %w", "test", context.DeadlineExceeded)
+
+	tests := []struct {
+		ctx  context.Context
+		err  error
+		want string
+	}{
+		{context.Background(), errors.New("exit status 1"), StatusFailure},
+		{context.Background(), timedOut, StatusTimedOut},
+		{cancelled, timedOut, StatusCancelled},
+		{cancelled, context.Canceled, StatusCancelled},
+	}
+	for _, test := range tests {
+		if got := failed(test.ctx, test.err); got.Status != test.want || got.Err != test.err || got.Succeeded() {
+			t.Errorf("failed(%v) = %s (%v), want %s", test.err, got.Status, got.Err, test.want)
+		}
+	}
+}
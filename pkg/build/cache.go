@@ -0,0 +1,319 @@
+// pkg/build/cache.go
+package build
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"buildy/pkg/cache"
+	"buildy/pkg/changelog"
+	"buildy/pkg/config"
+
+	"github.com/go-git/go-git/v5"
+	"gopkg.in/yaml.v2"
+)
+
+type cacheEntry struct {
+	Fingerprint string     `json:"fingerprint"`
+	Project     string     `json:"project"`
+	Version     string     `json:"version"`
+	BuiltAt     time.Time  `json:"builtAt"`
+	Artifacts   []Artifact `json:"artifacts,omitempty"`
+}
+
+// fingerprinter computes subproject fingerprints from their tracked input
+// files, build definition and env, and the fingerprints of their dependencies.
+type fingerprinter struct {
+	cfg          *config.Config
+	fingerprints map[string]string
+	visiting     map[string]bool
+}
+
+func newFingerprinter(cfg *config.Config) *fingerprinter {
+	return &fingerprinter{
+		cfg:          cfg,
+		fingerprints: make(map[string]string),
+		visiting:     make(map[string]bool),
+	}
+}
+
+func (f *fingerprinter) fingerprint(name string) (string, error) {
+	if fingerprint, ok := f.fingerprints[name]; ok {
+		return fingerprint, nil
+	}
+	if f.visiting[name] {
+		return "", fmt.Errorf("dependency cycle involving %s", name)
+	}
+	f.visiting[name] = true
+	defer delete(f.visiting, name)
+
+	subProject := f.cfg.GetSubProject(name)
+	if subProject == nil {
+		return "", fmt.Errorf("unknown subproject %s", name)
+	}
+
+	hash := sha256.New()
+
+	// Build definition. The version is left out on purpose: it is bumped after
+	// every successful build and would otherwise never produce a cache hit.
+	definition := *subProject
+	definition.Version = ""
+	data, err := yaml.Marshal(definition)
+	if err != nil {
+		return "", fmt.Errorf("error encoding build definition: %v", err)
+	}
+	fmt.Fprintf(hash, "definition %x\n", sha256.Sum256(data))
+	fmt.Fprintf(hash, "profile %s\n", f.cfg.Profile)
+
+	files, err := inputFiles(subProject.Path)
+	if err != nil {
+		return "", fmt.Errorf("error listing input files of %s: %v", name, err)
+	}
+	for _, file := range files {
+		sum, err := hashFile(filepath.Join(subProject.Path, file))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "file %s %s\n", filepath.ToSlash(file), sum)
+	}
+
+	dependencies := append([]string(nil), subProject.DependsOn...)
+	sort.Strings(dependencies)
+	for _, dependency := range dependencies {
+		dependencyFingerprint, err := f.fingerprint(dependency)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "dependency %s %s\n", dependency, dependencyFingerprint)
+	}
+
+	fingerprint := hex.EncodeToString(hash.Sum(nil))
+	f.fingerprints[name] = fingerprint
+	return fingerprint, nil
+}
+
+// inputFiles lists the files under path, relative to it, that make up a
+// subproject's inputs: the files Git tracks when path is inside a repository,
+// or every file otherwise.
+func inputFiles(path string) ([]string, error) {
+	var files []string
+
+	repo, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err == nil {
+		files, err = trackedFiles(repo, path)
+	} else {
+		files, err = walkFiles(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := files[:0]
+	for _, file := range files {
+		if !isGeneratedFile(file) {
+			inputs = append(inputs, file)
+		}
+	}
+	sort.Strings(inputs)
+
+	return inputs, nil
+}
+
+func trackedFiles(repo *git.Repository, path string) ([]string, error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	index, err := repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := filepath.Rel(worktree.Filesystem.Root(), absPath)
+	if err != nil {
+		return nil, err
+	}
+	prefix = filepath.ToSlash(prefix)
+
+	var files []string
+	for _, entry := range index.Entries {
+		if prefix == "." {
+			files = append(files, filepath.FromSlash(entry.Name))
+		} else if strings.HasPrefix(entry.Name, prefix+"/") {
+			files = append(files, filepath.FromSlash(strings.TrimPrefix(entry.Name, prefix+"/")))
+		}
+	}
+	return files, nil
+}
+
+func walkFiles(root string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	return files, err
+}
+
+// isGeneratedFile reports whether buildy writes file into a subproject
+// itself, so that it doesn't invalidate the subproject's cache
+func isGeneratedFile(file string) bool {
+	for _, generated := range changelog.Files() {
+		if file == generated {
+			return true
+		}
+	}
+	return false
+}
+
+// hashFile returns the sha256 of a file's content. Tracked files missing from
+// the working copy hash to a fixed marker so deleting them is still a change.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "deleted", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading input file: %v", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("error reading input file: %v", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Cache entries are keyed by fingerprint, so any agent sharing the store can
+// reuse a build of identical inputs. The entry is written after the artifacts
+// so a reader that finds it can rely on them being there.
+func cacheEntryKey(fingerprint string) string {
+	return fingerprint + "/entry.json"
+}
+
+func cacheArtifactKey(fingerprint, name string) string {
+	return fingerprint + "/artifacts/" + name
+}
+
+// loadCacheEntry returns the entry of a successful build with this
+// fingerprint, or nil if there is none.
+func loadCacheEntry(store cache.Store, fingerprint string) (*cacheEntry, error) {
+	content, err := store.Get(cacheEntryKey(fingerprint))
+	if errors.Is(err, cache.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	var entry cacheEntry
+	err = json.NewDecoder(content).Decode(&entry)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding cache entry: %v", err)
+	}
+	return &entry, nil
+}
+
+// saveCacheEntry uploads the artifacts of a successful build, then its entry.
+// Each store of a MultiStore is written on its own, so one that fails, such
+// as an unreachable shared cache, doesn't keep the entry from the others and
+// doesn't get an entry without its artifacts.
+func saveCacheEntry(store cache.Store, entry cacheEntry) error {
+	multi, ok := store.(cache.MultiStore)
+	if !ok {
+		return saveCacheEntryTo(store, entry)
+	}
+
+	var errs []string
+	for _, store := range multi {
+		if err := saveCacheEntryTo(store, entry); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func saveCacheEntryTo(store cache.Store, entry cacheEntry) error {
+	for _, artifact := range entry.Artifacts {
+		file, err := os.Open(artifact.Path)
+		if err != nil {
+			return fmt.Errorf("error reading artifact: %v", err)
+		}
+		err = store.Put(cacheArtifactKey(entry.Fingerprint, artifact.Name), file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding cache entry: %v", err)
+	}
+	return store.Put(cacheEntryKey(entry.Fingerprint), bytes.NewReader(data))
+}
+
+// restoreArtifacts downloads a cached build's artifacts into destDir,
+// verifying their checksums.
+func restoreArtifacts(store cache.Store, entry *cacheEntry, destDir string) ([]Artifact, error) {
+	err := os.RemoveAll(destDir)
+	if err != nil {
+		return nil, fmt.Errorf("error clearing artifact directory: %v", err)
+	}
+
+	var artifacts []Artifact
+	for _, cached := range entry.Artifacts {
+		content, err := store.Get(cacheArtifactKey(entry.Fingerprint, cached.Name))
+		if err != nil {
+			return nil, fmt.Errorf("error fetching artifact %s: %v", cached.Name, err)
+		}
+		// Entries recorded before modes were kept have none
+		mode := cached.Mode
+		if mode == 0 {
+			mode = 0644
+		}
+		artifact, err := writeArtifact(content, destDir, cached.Name, mode)
+		content.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error restoring artifact %s: %v", cached.Name, err)
+		}
+		if artifact.SHA256 != cached.SHA256 {
+			return nil, fmt.Errorf("checksum mismatch for cached artifact %s", cached.Name)
+		}
+		artifacts = append(artifacts, artifact)
+	}
+
+	return artifacts, writeChecksums(destDir, artifacts)
+}
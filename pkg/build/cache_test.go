@@ -0,0 +1,204 @@
+// pkg/build/cache_test.go
+package build
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"buildy/pkg/cache"
+	"buildy/pkg/config"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func fingerprintOf(t *testing.T, cfg *config.Config, name string) string {
+	t.Helper()
+	fingerprint, err := newFingerprinter(cfg).fingerprint(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fingerprint
+}
+
+func TestFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a/main.go": "package main", "b/lib.go": "package lib"})
+	cfg := &config.Config{SubProjects: []config.SubProject{
+		{Name: "a", Version: "1.0.0", Path: filepath.Join(dir, "a"), BuildCmd: []string{"go build"}, DependsOn: []string{"b"}},
+		{Name: "b", Version: "1.0.0", Path: filepath.Join(dir, "b"), BuildCmd: []string{"go build"}},
+	}}
+	base := fingerprintOf(t, cfg, "a")
+
+	if fingerprintOf(t, cfg, "a") != base {
+		t.Fatal("fingerprint is not stable")
+	}
+
+	// The version is bumped after each build and must not change the fingerprint
+	cfg.SubProjects[0].Version = "1.0.1"
+	if fingerprintOf(t, cfg, "a") != base {
+		t.Error("fingerprint changed with the version")
+	}
+
+	// Neither do the changelogs buildy writes into the subproject
+	writeFiles(t, dir, map[string]string{"a/CHANGELOG.md": "## [1.0.1]", "a/changelog.json": "{}"})
+	if fingerprintOf(t, cfg, "a") != base {
+		t.Error("fingerprint changed with a generated changelog")
+	}
+
+	cfg.SubProjects[0].BuildCmd = []string{"go build -race"}
+	if fingerprintOf(t, cfg, "a") == base {
+		t.Error("fingerprint didn't change with the build definition")
+	}
+	cfg.SubProjects[0].BuildCmd = []string{"go build"}
+
+	writeFiles(t, dir, map[string]string{"b/lib.go": "package lib // changed"})
+	if fingerprintOf(t, cfg, "a") == base {
+		t.Error("fingerprint didn't change with an input of a dependency")
+	}
+}
+
+func TestFingerprintDependencyCycle(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{SubProjects: []config.SubProject{
+		{Name: "a", Path: dir, DependsOn: []string{"b"}},
+		{Name: "b", Path: dir, DependsOn: []string{"a"}},
+	}}
+	if _, err := newFingerprinter(cfg).fingerprint("a"); err == nil {
+		t.Fatal("expected an error for a dependency cycle")
+	}
+}
+
+func TestCacheKeys(t *testing.T) {
+	if key := cacheEntryKey("abc"); key != "abc/entry.json" {
+		t.Errorf("cacheEntryKey = %s", key)
+	}
+	if key := cacheArtifactKey("abc", "dist/app"); key != "abc/artifacts/dist/app" {
+		t.Errorf("cacheArtifactKey = %s", key)
+	}
+}
+
+// unreachableStore fails to store artifacts and records the keys it gets
+type unreachableStore struct {
+	keys []string
+}
+
+func (s *unreachableStore) Get(key string) (io.ReadCloser, error) {
+	return nil, cache.ErrNotFound
+}
+
+func (s *unreachableStore) Put(key string, content io.Reader) error {
+	s.keys = append(s.keys, key)
+	if strings.HasSuffix(key, "/entry.json") {
+		return nil
+	}
+	return errors.New("connection refused")
+}
+
+func TestSaveCacheEntryToMultiStore(t *testing.T) {
+	dir := t.TempDir()
+	local, err := cache.NewDirStore(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := &unreachableStore{}
+
+	writeFiles(t, dir, map[string]string{"src/dist/app": "binary"})
+	artifacts, err := collectArtifacts(filepath.Join(dir, "src"), config.SubProject{Outputs: []string{"dist/*"}}, filepath.Join(dir, "artifacts", "1.0.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = saveCacheEntry(cache.MultiStore{shared, local}, cacheEntry{Fingerprint: "abc", Project: "a", Version: "1.0.0", Artifacts: artifacts})
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("saveCacheEntry error = %v, want the shared cache's", err)
+	}
+
+	// The local cache gets the whole entry
+	entry, err := loadCacheEntry(local, "abc")
+	if err != nil || entry == nil {
+		t.Fatalf("local entry = %v, %v", entry, err)
+	}
+	if _, err := restoreArtifacts(local, entry, filepath.Join(dir, "restored")); err != nil {
+		t.Error(err)
+	}
+	// and the shared one no entry without its artifacts
+	if want := []string{cacheArtifactKey("abc", "dist/app")}; !reflect.DeepEqual(shared.keys, want) {
+		t.Errorf("shared cache got %q, want only %q", shared.keys, want)
+	}
+}
+
+func TestCacheEntryRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	store, err := cache.NewDirStore(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := loadCacheEntry(store, "abc")
+	if err != nil || entry != nil {
+		t.Fatalf("loadCacheEntry of a missing entry = %v, %v, want nil, nil", entry, err)
+	}
+
+	writeFiles(t, dir, map[string]string{"src/dist/app": "binary", "src/dist/app.txt": "notes"})
+	if err := os.Chmod(filepath.Join(dir, "src", "dist", "app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	artifacts, err := collectArtifacts(filepath.Join(dir, "src"), config.SubProject{Outputs: []string{"dist/*"}}, filepath.Join(dir, "artifacts", "1.0.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = saveCacheEntry(store, cacheEntry{Fingerprint: "abc", Project: "a", Version: "1.0.0", BuiltAt: time.Now(), Artifacts: artifacts})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err = loadCacheEntry(store, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Project != "a" || entry.Version != "1.0.0" || len(entry.Artifacts) != 2 {
+		t.Fatalf("loaded entry = %+v", entry)
+	}
+
+	restored, err := restoreArtifacts(store, entry, filepath.Join(dir, "restored"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(restored[0].Path)
+	if err != nil || string(data) != "binary" {
+		t.Errorf("restored artifact = %q, %v", data, err)
+	}
+
+	// The exec bit survives the round trip
+	for _, artifact := range restored {
+		info, err := os.Stat(artifact.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := os.FileMode(0644)
+		if artifact.Name == "dist/app" {
+			want = 0755
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm() != want {
+			t.Errorf("restored %s has mode %v, want %v", artifact.Name, info.Mode().Perm(), want)
+		}
+	}
+}
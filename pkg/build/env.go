@@ -0,0 +1,150 @@
+// pkg/build/env.go
+package build
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"buildy/pkg/config"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// buildEnv assembles the environment for a subproject's build commands. Later
+// sources win: base (the buildy process environment, or a scrubbed one in a
+// sandbox), then envFile, then env, then the BUILDY_* variables, which are
+// always set by buildy itself. BUILDY_VERSION is the version the subproject is
+// released as, which its artifacts are collected under. envFile is read from
+// the subproject directory even when sandboxed, since it is usually kept out
+// of Git and so isn't copied into the sandbox.
+func buildEnv(subProject config.SubProject, base map[string]string, opts Options) (map[string]string, error) {
+	vars := make(map[string]string, len(base))
+	for k, v := range base {
+		vars[k] = v
+	}
+
+	if subProject.EnvFile != "" {
+		fileVars, err := readEnvFile(filepath.Join(subProject.Path, subProject.EnvFile))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range fileVars {
+			vars[k] = v
+		}
+	}
+
+	for k, v := range subProject.Env {
+		vars[k] = v
+	}
+
+	outputDir, err := filepath.Abs(opts.OutputDir)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving output directory: %v", err)
+	}
+	vars["BUILDY_PROJECT"] = subProject.Name
+	vars["BUILDY_VERSION"] = opts.releaseVersion(subProject)
+	vars["BUILDY_COMMIT"] = headCommit(subProject.Path)
+	vars["BUILDY_OUTPUT_DIR"] = outputDir
+
+	return vars, nil
+}
+
+func processEnv() map[string]string {
+	vars := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if i := strings.Index(kv, "="); i > 0 {
+			vars[kv[:i]] = kv[i+1:]
+		}
+	}
+	return vars
+}
+
+// envList merges a step's env over the subproject environment and returns it
+// in the KEY=VALUE form exec.Cmd expects. BUILDY_* variables can't be overridden.
+func envList(vars map[string]string, overrides map[string]string) []string {
+	merged := make(map[string]string, len(vars)+len(overrides))
+	for k, v := range vars {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		if !strings.HasPrefix(k, "BUILDY_") {
+			merged[k] = v
+		}
+	}
+
+	env := make([]string, 0, len(merged))
+	for k, v := range merged {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+
+	return env
+}
+
+// readEnvFile parses KEY=VALUE lines, ignoring blank lines, # comments and
+// an optional "export " prefix. Values may be wrapped in single or double quotes.
+func readEnvFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading env file: %v", err)
+	}
+	defer file.Close()
+
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		i := strings.Index(line, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid line %d in env file %s", lineNo, path)
+		}
+		key := strings.TrimSpace(line[:i])
+		value := strings.TrimSpace(line[i+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading env file: %v", err)
+	}
+
+	return vars, nil
+}
+
+// headBranch returns the branch checked out in the repository containing
+// path, or an empty string for a detached HEAD or when there is no repository.
+func headBranch(path string) string {
+	repo, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return ""
+	}
+	head, err := repo.Head()
+	if err != nil || !head.Name().IsBranch() {
+		return ""
+	}
+	return head.Name().Short()
+}
+
+// headCommit returns the HEAD commit of the repository containing path, or
+// an empty string when path isn't inside a Git repository.
+func headCommit(path string) string {
+	repo, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return ""
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return ""
+	}
+	return head.Hash().String()
+}
@@ -0,0 +1,133 @@
+// pkg/build/env_test.go
+package build
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"buildy/pkg/config"
+)
+
+func TestReadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	content := `# Comments and blank lines are ignored
+
+PLAIN=value
+  SPACED  =  padded value  
+export EXPORTED=yes
+DOUBLE="quoted # not a comment"
+SINGLE='single quoted'
+MISMATCHED="open
+EMPTY=
+EMPTY_QUOTES=""
+EQUALS=a=b=c
+	# indented comment
+INNER=say "hi"
+`
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	vars, err := readEnvFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"PLAIN":        "value",
+		"SPACED":       "padded value",
+		"EXPORTED":     "yes",
+		"DOUBLE":       "quoted # not a comment",
+		"SINGLE":       "single quoted",
+		"MISMATCHED":   `"open`,
+		"EMPTY":        "",
+		"EMPTY_QUOTES": "",
+		"EQUALS":       "a=b=c",
+		"INNER":        `say "hi"`,
+	}
+	if !reflect.DeepEqual(vars, want) {
+		t.Errorf("readEnvFile = %q, want %q", vars, want)
+	}
+}
+
+func TestReadEnvFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"A=1\nnot a variable\n", "invalid line 2"},
+		{"A=1\n\n# comment\n=value\n", "invalid line 4"},
+		{"export\n", "invalid line 1"},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, ".env")
+		if err := ioutil.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readEnvFile(path); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("readEnvFile(%q) error = %v, want %q", test.content, err, test.want)
+		}
+	}
+
+	if _, err := readEnvFile(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing env file")
+	}
+}
+
+func TestBuildEnvPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a/.env": "FROM_FILE=file\nOVERRIDDEN=file\nBUILDY_PROJECT=file\n",
+	})
+	subProject := config.SubProject{
+		Name:    "a",
+		Version: "1.0.0",
+		Path:    filepath.Join(dir, "a"),
+		EnvFile: ".env",
+		Env:     map[string]string{"OVERRIDDEN": "env", "FROM_ENV": "env", "BUILDY_VERSION": "env"},
+	}
+	base := map[string]string{"FROM_BASE": "base", "FROM_FILE": "base", "OVERRIDDEN": "base", "BUILDY_OUTPUT_DIR": "base"}
+	opts := Options{OutputDir: filepath.Join(dir, "reports"), ReleaseVersions: map[string]string{"a": "1.1.0"}}
+
+	vars, err := buildEnv(subProject, base, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		// base < envFile < env < BUILDY_*
+		"FROM_BASE":         "base",
+		"FROM_FILE":         "file",
+		"FROM_ENV":          "env",
+		"OVERRIDDEN":        "env",
+		"BUILDY_PROJECT":    "a",
+		"BUILDY_VERSION":    "1.1.0",
+		"BUILDY_OUTPUT_DIR": opts.OutputDir,
+	} {
+		if vars[key] != want {
+			t.Errorf("%s = %q, want %q", key, vars[key], want)
+		}
+	}
+	if base["FROM_FILE"] != "base" {
+		t.Error("buildEnv changed the base environment")
+	}
+
+	// A step's env wins over everything but BUILDY_*
+	env := envList(vars, map[string]string{"OVERRIDDEN": "step", "BUILDY_VERSION": "step"})
+	for _, kv := range []string{"OVERRIDDEN=step", "BUILDY_VERSION=1.1.0", "FROM_BASE=base"} {
+		found := false
+		for _, e := range env {
+			found = found || e == kv
+		}
+		if !found {
+			t.Errorf("step environment %q is missing %s", env, kv)
+		}
+	}
+
+	subProject.EnvFile = "missing.env"
+	if _, err := buildEnv(subProject, base, opts); err == nil {
+		t.Error("expected an error for a missing env file")
+	}
+}
@@ -0,0 +1,71 @@
+// pkg/build/logs.go
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Number of lines at the end of a failed subproject's log kept in its result
+const logTailLines = 50
+
+// Size of the chunks logTail reads a log in, from the end
+var logChunkSize = 16 * 1024
+
+// openLog creates the log file for a subproject's command output in logDir
+func openLog(logDir, name string) (*os.File, error) {
+	err := os.MkdirAll(logDir, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("error creating log directory: %v", err)
+	}
+
+	file, err := os.Create(filepath.Join(logDir, name+".log"))
+	if err != nil {
+		return nil, fmt.Errorf("error creating log file: %v", err)
+	}
+	return file, nil
+}
+
+// logTail returns the last n lines of a log file
+func logTail(path string, n int) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	// Read backwards in chunks until there are enough lines, so huge logs
+	// aren't read in full. The last n lines are complete once the newline
+	// before them is read, not counting blank lines at the end.
+	var data []byte
+	offset := info.Size()
+	for offset > 0 && bytes.Count(bytes.TrimRight(data, "\n"), []byte("\n")) < n {
+		size := int64(logChunkSize)
+		if offset < size {
+			size = offset
+		}
+		offset -= size
+
+		chunk := make([]byte, size)
+		_, err := file.ReadAt(chunk, offset)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		data = append(chunk, data...)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n"), nil
+}
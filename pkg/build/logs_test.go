@@ -0,0 +1,59 @@
+// pkg/build/logs_test.go
+package build
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogTail(t *testing.T) {
+	var long []string
+	for i := 1; i <= 100; i++ {
+		long = append(long, fmt.Sprintf("line %d", i))
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		n       int
+		want    string
+	}{
+		{"empty", "", 3, ""},
+		{"shorter than the tail", "a\nb\n", 3, "a\nb"},
+		{"exactly the tail", "a\nb\nc\n", 3, "a\nb\nc"},
+		{"longer than the tail", "a\nb\nc\nd\n", 2, "c\nd"},
+		{"no trailing newline", "a\nb\nc", 2, "b\nc"},
+		{"single line without newline", "only", 3, "only"},
+		{"blank lines at the end", "a\nb\nc\n\n\n", 2, "b\nc"},
+		{"blank lines inside", "a\n\nb\n", 2, "\nb"},
+		{"spans chunks", strings.Join(long, "\n") + "\n", 50, strings.Join(long[50:], "\n")},
+		{"spans chunks without trailing newline", strings.Join(long, "\n"), 3, "line 98\nline 99\nline 100"},
+		{"whole log in chunks", strings.Join(long, "\n") + "\n\n", 200, strings.Join(long, "\n")},
+	}
+
+	// Small chunks so that lines cross their boundaries
+	defer func(size int) { logChunkSize = size }(logChunkSize)
+	for _, chunkSize := range []int{16 * 1024, 7, 1} {
+		logChunkSize = chunkSize
+		for _, test := range tests {
+			path := filepath.Join(t.TempDir(), "a.log")
+			if err := ioutil.WriteFile(path, []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := logTail(path, test.n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("%s with %d byte chunks: logTail = %q, want %q", test.name, chunkSize, got, test.want)
+			}
+		}
+	}
+
+	if _, err := logTail(filepath.Join(t.TempDir(), "missing.log"), 3); err == nil {
+		t.Error("expected an error for a missing log")
+	}
+}
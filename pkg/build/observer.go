@@ -0,0 +1,27 @@
+// pkg/build/observer.go
+package build
+
+import (
+	"io"
+	"os"
+)
+
+// Observer follows a build as it happens, e.g. to show progress. With
+// parallel builds its methods are called from several goroutines.
+type Observer interface {
+	// Output returns the writer for the output of a subproject's commands
+	Output(name string) io.Writer
+	SubProjectStarted(name string)
+	StepStarted(name, phase, step string)
+	// SubProjectFinished is called for every subproject, including those
+	// that were cached, skipped or cancelled without starting
+	SubProjectFinished(name string, result *Result)
+}
+
+// stdoutObserver passes command output straight through to stdout
+type stdoutObserver struct{}
+
+func (stdoutObserver) Output(string) io.Writer            { return os.Stdout }
+func (stdoutObserver) SubProjectStarted(string)           {}
+func (stdoutObserver) StepStarted(string, string, string) {}
+func (stdoutObserver) SubProjectFinished(string, *Result) {}
@@ -0,0 +1,45 @@
+//go:build !windows
+
+// pkg/build/proc_unix.go
+package build
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// How long a terminated process group gets to exit before it is killed
+var killGracePeriod = 5 * time.Second
+
+// setProcessGroup starts the command in a new process group so that anything
+// it spawns can be signalled together with it.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func terminateProcessGroup(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// maxRSS returns the peak resident set size of a finished process in bytes.
+// getrusage reports it in kilobytes everywhere but macOS. It is an upper
+// bound: the process is forked from buildy, whose own memory counts towards
+// the peak until the command is exec'd, so even a trivial command reports
+// buildy's RSS (tens of MiB).
+func maxRSS(state *os.ProcessState) int64 {
+	usage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	if runtime.GOOS == "darwin" {
+		return int64(usage.Maxrss)
+	}
+	return int64(usage.Maxrss) * 1024
+}
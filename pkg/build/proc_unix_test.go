@@ -0,0 +1,149 @@
+//go:build !windows
+
+// pkg/build/proc_unix_test.go
+package build
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"buildy/pkg/config"
+	"buildy/pkg/logging"
+)
+
+func runShell(ctx context.Context, t *testing.T, dir, command string, timeout time.Duration) (error, time.Duration) {
+	t.Helper()
+	start := time.Now()
+	err := runCommand(ctx, shellCommand("", command), dir, os.Environ(), ioutil.Discard, timeout)
+	return err, time.Since(start)
+}
+
+func TestRunCommand(t *testing.T) {
+	dir := t.TempDir()
+	if err, _ := runShell(context.Background(), t, dir, "echo ok > out", 0); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "out")); string(data) != "ok\n" {
+		t.Errorf("command ran in the wrong directory: out = %q", data)
+	}
+	if err, _ := runShell(context.Background(), t, dir, "exit 3", 0); err == nil {
+		t.Error("expected an error for a failing command")
+	}
+}
+
+func TestRunCommandTimeout(t *testing.T) {
+	err, elapsed := runShell(context.Background(), t, t.TempDir(), "sleep 30", 100*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Errorf("err = %v, want a timeout", err)
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("timed out command took %s to stop", elapsed)
+	}
+}
+
+func TestRunCommandKillsProcessGroup(t *testing.T) {
+	dir := t.TempDir()
+	// The background sleep is in the command's process group, and outlives
+	// the shell unless the whole group is signalled
+	err, _ := runShell(context.Background(), t, dir, "sleep 30 & echo $! > pid; wait", 300*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want a timeout", err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "pid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for syscall.Kill(pid, 0) == nil {
+		if time.Now().After(deadline) {
+			syscall.Kill(pid, syscall.SIGKILL)
+			t.Fatal("child process survived the timeout")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRunCommandKillsAfterGracePeriod(t *testing.T) {
+	defer func(grace time.Duration) { killGracePeriod = grace }(killGracePeriod)
+	killGracePeriod = 200 * time.Millisecond
+
+	err, elapsed := runShell(context.Background(), t, t.TempDir(), `trap "" TERM; sleep 30`, 100*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want a timeout", err)
+	}
+	if elapsed < 300*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("command ignoring SIGTERM stopped after %s, want the timeout plus the grace period", elapsed)
+	}
+}
+
+func TestRunCommandCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	err, _ := runShell(ctx, t, t.TempDir(), "sleep 30", time.Minute)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func retryStep(run string, retries int) config.Step {
+	return config.Step{Name: "test", Run: run, Retries: &retries}
+}
+
+// countAttempts counts runs in a file and succeeds from the given attempt on
+func countAttempts(succeedOn int) string {
+	return `n=$(cat count 2>/dev/null || echo 0); n=$((n+1)); echo $n > count; [ $n -ge ` + strconv.Itoa(succeedOn) + ` ]`
+}
+
+func TestRunWithRetries(t *testing.T) {
+	logger := logging.NewLogger(ioutil.Discard)
+	subProject := config.SubProject{Name: "a", RetryBackoff: 50 * time.Millisecond}
+
+	var result StepResult
+	start := time.Now()
+	err := runWithRetries(context.Background(), subProject, retryStep(countAttempts(3), 2), t.TempDir(), os.Environ(), ioutil.Discard, ioutil.Discard, &result, logger)
+	if err != nil {
+		t.Fatalf("step failed after %d attempts: %v", result.Attempts, err)
+	}
+	if result.Attempts != 3 || result.ExitCode != 0 {
+		t.Errorf("attempts = %d, exit code %d, want 3 and 0", result.Attempts, result.ExitCode)
+	}
+	// Backoff doubles: 50ms, then 100ms
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("retries took %s, want at least 150ms of backoff", elapsed)
+	}
+
+	result = StepResult{}
+	err = runWithRetries(context.Background(), subProject, retryStep(countAttempts(3), 1), t.TempDir(), os.Environ(), ioutil.Discard, ioutil.Discard, &result, logger)
+	if err == nil || result.Attempts != 2 || result.ExitCode != 1 {
+		t.Errorf("err = %v after %d attempts with exit code %d, want a failure after 2 with exit code 1", err, result.Attempts, result.ExitCode)
+	}
+}
+
+func TestRunWithRetriesCancelledDuringBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	subProject := config.SubProject{Name: "a", RetryBackoff: time.Minute}
+
+	var result StepResult
+	start := time.Now()
+	err := runWithRetries(ctx, subProject, retryStep("exit 1", 5), t.TempDir(), os.Environ(), ioutil.Discard, ioutil.Discard, &result, logging.NewLogger(ioutil.Discard))
+	if !errors.Is(err, context.Canceled) || result.Attempts != 1 {
+		t.Errorf("err = %v after %d attempts, want context.Canceled after 1", err, result.Attempts)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("cancelled retries took %s", elapsed)
+	}
+}
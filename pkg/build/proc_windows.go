@@ -0,0 +1,31 @@
+//go:build windows
+
+// pkg/build/proc_windows.go
+package build
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// Windows has no graceful group signal, so termination is immediate
+var killGracePeriod = 0 * time.Second
+
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+func terminateProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+// maxRSS isn't available from a Windows process state
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
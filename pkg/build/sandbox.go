@@ -0,0 +1,103 @@
+// pkg/build/sandbox.go
+package build
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"buildy/pkg/config"
+)
+
+// Variables passed through from the buildy environment into a sandbox. On
+// Windows a few more are needed for processes to start at all.
+var sandboxPassthroughEnv = []string{"PATH", "LANG", "TERM"}
+var sandboxPassthroughEnvWindows = []string{"SystemRoot", "ComSpec", "PATHEXT"}
+
+// sandbox is a throwaway directory holding a copy of a subproject's input
+// files (src), the artifacts of its dependencies (deps/<name>) and private
+// home and temp directories.
+type sandbox struct {
+	root string
+}
+
+func (s *sandbox) src() string  { return filepath.Join(s.root, "src") }
+func (s *sandbox) deps() string { return filepath.Join(s.root, "deps") }
+func (s *sandbox) home() string { return filepath.Join(s.root, "home") }
+func (s *sandbox) tmp() string  { return filepath.Join(s.root, "tmp") }
+
+// newSandbox copies the subproject's input files, the same ones its
+// fingerprint covers, and its dependencies' artifacts into a new sandbox.
+func newSandbox(subProject config.SubProject, buildResults map[string]*Result) (*sandbox, error) {
+	root, err := ioutil.TempDir("", "buildy-sandbox-"+subProject.Name+"-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating sandbox: %v", err)
+	}
+	s := &sandbox{root: root}
+
+	for _, dir := range []string{s.src(), s.deps(), s.home(), s.tmp()} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			s.remove()
+			return nil, fmt.Errorf("error creating sandbox: %v", err)
+		}
+	}
+
+	files, err := inputFiles(subProject.Path)
+	if err != nil {
+		s.remove()
+		return nil, fmt.Errorf("error listing input files: %v", err)
+	}
+	for _, file := range files {
+		name := filepath.ToSlash(file)
+		if _, err := copyArtifact(filepath.Join(subProject.Path, file), s.src(), name); err != nil && !os.IsNotExist(err) {
+			s.remove()
+			return nil, fmt.Errorf("error copying %s into sandbox: %v", file, err)
+		}
+	}
+
+	for _, dependency := range subProject.DependsOn {
+		result := buildResults[dependency]
+		if result == nil {
+			continue
+		}
+		for _, artifact := range result.Artifacts {
+			if _, err := copyArtifact(artifact.Path, filepath.Join(s.deps(), dependency), artifact.Name); err != nil {
+				s.remove()
+				return nil, fmt.Errorf("error copying %s output %s into sandbox: %v", dependency, artifact.Name, err)
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// env returns the scrubbed base environment for commands in the sandbox
+func (s *sandbox) env() map[string]string {
+	keys := sandboxPassthroughEnv
+	if runtime.GOOS == "windows" {
+		keys = append(keys, sandboxPassthroughEnvWindows...)
+	}
+
+	vars := make(map[string]string)
+	for _, key := range keys {
+		if value, ok := os.LookupEnv(key); ok {
+			vars[key] = value
+		}
+	}
+	vars["HOME"] = s.home()
+	if runtime.GOOS == "windows" {
+		vars["USERPROFILE"] = s.home()
+	}
+	vars["TMPDIR"] = s.tmp()
+	vars["TEMP"] = s.tmp()
+	vars["TMP"] = s.tmp()
+	vars["BUILDY_DEPS_DIR"] = s.deps()
+
+	return vars
+}
+
+func (s *sandbox) remove() error {
+	return os.RemoveAll(s.root)
+}
@@ -0,0 +1,223 @@
+// pkg/build/steps.go
+package build
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"buildy/pkg/config"
+)
+
+// Phases run in this order; steps without a phase belong to "build"
+var phases = []string{"pre-build", "build", "test", "package", "post-build"}
+
+const defaultPhase = "build"
+
+type StepResult struct {
+	Name      string
+	Phase     string
+	Command   string
+	Status    string
+	Err       error
+	StartTime time.Time
+	EndTime   time.Time
+	Duration  time.Duration
+
+	// Attempts is how many times the command ran, zero for skipped steps.
+	// ExitCode is that of the last attempt, -1 if it was killed by a signal.
+	Attempts int
+	ExitCode int
+	// CPUTime (user and system) is summed and MaxRSS (in bytes) peaked
+	// over all attempts, including the processes each one waited for.
+	// MaxRSS is an upper bound that includes buildy's own RSS (see maxRSS).
+	CPUTime time.Duration
+	MaxRSS  int64
+}
+
+// recordAttempt adds the usage of one run of the step's command. state is
+// nil when the command couldn't be started.
+func (s *StepResult) recordAttempt(state *os.ProcessState) {
+	s.Attempts++
+	if state == nil {
+		s.ExitCode = -1
+		return
+	}
+
+	s.ExitCode = state.ExitCode()
+	s.CPUTime += state.UserTime() + state.SystemTime()
+	if rss := maxRSS(state); rss > s.MaxRSS {
+		s.MaxRSS = rss
+	}
+}
+
+// resolveSteps turns BuildCmd and Steps into one ordered list. BuildCmd
+// entries become unnamed build-phase steps ahead of any declared build steps,
+// and subproject-wide timeouts and retries fill in what a step doesn't set.
+func resolveSteps(subProject config.SubProject) ([]config.Step, error) {
+	var steps []config.Step
+	for _, command := range subProject.BuildCmd {
+		steps = append(steps, config.Step{Run: command})
+	}
+	steps = append(steps, subProject.Steps...)
+
+	for i := range steps {
+		step := &steps[i]
+		if step.Run == "" {
+			return nil, fmt.Errorf("step %d has nothing to run", i+1)
+		}
+		if step.Name == "" {
+			step.Name = step.Run
+		}
+		if step.Phase == "" {
+			step.Phase = defaultPhase
+		}
+		if phaseIndex(step.Phase) < 0 {
+			return nil, fmt.Errorf("step %q has unknown phase %q (expected one of %s)", step.Name, step.Phase, strings.Join(phases, ", "))
+		}
+		if step.Timeout == 0 {
+			step.Timeout = subProject.CommandTimeout
+		}
+		if step.Retries == nil {
+			retries := subProject.Retries
+			step.Retries = &retries
+		}
+	}
+
+	sort.SliceStable(steps, func(i, j int) bool {
+		return phaseIndex(steps[i].Phase) < phaseIndex(steps[j].Phase)
+	})
+
+	return steps, nil
+}
+
+func phaseIndex(phase string) int {
+	for i, p := range phases {
+		if p == phase {
+			return i
+		}
+	}
+	return -1
+}
+
+// evaluateCondition evaluates a step's `if` expression. Terms compare an
+// operand with == or !=, or test a single operand for being non-empty, and
+// are combined with && and || (&& binds tighter). Operands are quoted
+// strings, branch, profile, project or env.NAME.
+func evaluateCondition(expr string, vars map[string]string, env map[string]string) (bool, error) {
+	tokens, err := tokenizeCondition(expr)
+	if err != nil {
+		return false, fmt.Errorf("invalid condition %q: %v", expr, err)
+	}
+	if len(tokens) == 0 {
+		return true, nil
+	}
+
+	// Every alternative is checked, even after a match, so that a malformed
+	// condition fails whatever the values are
+	result := false
+	for _, alternative := range splitTokens(tokens, "||") {
+		matched := true
+		for _, term := range splitTokens(alternative, "&&") {
+			ok, err := evaluateTerm(term, vars, env)
+			if err != nil {
+				return false, fmt.Errorf("invalid condition %q: %v", expr, err)
+			}
+			matched = matched && ok
+		}
+		result = result || matched
+	}
+
+	return result, nil
+}
+
+// tokenizeCondition splits a condition into operators (==, !=, &&, ||),
+// quoted strings, kept with their quotes, and bare words
+func tokenizeCondition(expr string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		switch c := expr[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at %q", expr[i:])
+			}
+			tokens = append(tokens, expr[i:i+end+2])
+			i += end + 2
+		case isConditionOperator(expr[i:]):
+			tokens = append(tokens, expr[i:i+2])
+			i += 2
+		default:
+			start := i
+			for i < len(expr) && !strings.ContainsRune(" \t\n'\"", rune(expr[i])) && !isConditionOperator(expr[i:]) {
+				i++
+			}
+			tokens = append(tokens, expr[start:i])
+		}
+	}
+	return tokens, nil
+}
+
+func isConditionOperator(s string) bool {
+	for _, op := range []string{"==", "!=", "&&", "||"} {
+		if strings.HasPrefix(s, op) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTokens splits tokens around each sep token
+func splitTokens(tokens []string, sep string) [][]string {
+	var parts [][]string
+	start := 0
+	for i, token := range tokens {
+		if token == sep {
+			parts = append(parts, tokens[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, tokens[start:])
+}
+
+func evaluateTerm(term []string, vars map[string]string, env map[string]string) (bool, error) {
+	switch {
+	case len(term) == 1:
+		value, err := operand(term[0], vars, env)
+		return value != "", err
+	case len(term) == 3 && (term[1] == "==" || term[1] == "!="):
+		left, err := operand(term[0], vars, env)
+		if err != nil {
+			return false, err
+		}
+		right, err := operand(term[2], vars, env)
+		if err != nil {
+			return false, err
+		}
+		return (left == right) == (term[1] == "=="), nil
+	case len(term) == 0:
+		return false, fmt.Errorf("missing operand")
+	}
+	return false, fmt.Errorf("unexpected %q", strings.Join(term, " "))
+}
+
+func operand(token string, vars map[string]string, env map[string]string) (string, error) {
+	switch {
+	case isConditionOperator(token):
+		return "", fmt.Errorf("missing operand before %s", token)
+	case len(token) >= 2 && (token[0] == '\'' || token[0] == '"') && token[len(token)-1] == token[0]:
+		return token[1 : len(token)-1], nil
+	case strings.HasPrefix(token, "env."):
+		return env[strings.TrimPrefix(token, "env.")], nil
+	}
+
+	value, ok := vars[token]
+	if !ok {
+		return "", fmt.Errorf("unknown operand %q", token)
+	}
+	return value, nil
+}
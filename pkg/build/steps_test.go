@@ -0,0 +1,86 @@
+// pkg/build/steps_test.go
+package build
+
+import (
+	"testing"
+
+	"buildy/pkg/config"
+)
+
+func TestEvaluateCondition(t *testing.T) {
+	vars := map[string]string{"branch": "a||b", "profile": "prod", "project": "api"}
+	env := map[string]string{"CI": "true"}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"", true},
+		{"branch == 'a||b'", true},
+		{"branch == \"a&&b\"", false},
+		{"branch != 'a||b' || profile == 'prod'", true},
+		{"profile == 'prod' && project == 'web' || env.CI", true},
+		{"profile == 'prod' && project == 'web'", false},
+		{"env.CI && env.MISSING", false},
+		{"profile=='prod'&&project=='api'", true},
+		{"'x == y' == 'x == y'", true},
+	}
+	for _, test := range tests {
+		got, err := evaluateCondition(test.expr, vars, env)
+		if err != nil {
+			t.Errorf("evaluateCondition(%q): %v", test.expr, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("evaluateCondition(%q) = %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestEvaluateConditionErrors(t *testing.T) {
+	vars := map[string]string{"branch": "main"}
+	for _, expr := range []string{
+		"branch == 'main",
+		"branch ==",
+		"== 'main'",
+		"branch == 'main' ||",
+		"branch == 'main' || unknown",
+		"branch 'main'",
+	} {
+		if _, err := evaluateCondition(expr, vars, nil); err == nil {
+			t.Errorf("evaluateCondition(%q): expected an error", expr)
+		}
+	}
+}
+
+func TestResolveStepsRetries(t *testing.T) {
+	zero, one := 0, 1
+	subProject := config.SubProject{
+		Retries: 3,
+		Steps: []config.Step{
+			{Name: "default", Run: "true"},
+			{Name: "none", Run: "true", Retries: &zero},
+			{Name: "one", Run: "true", Retries: &one},
+		},
+	}
+	steps, err := resolveSteps(subProject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int{"default": 3, "none": 0, "one": 1}
+	for _, step := range steps {
+		if *step.Retries != want[step.Name] {
+			t.Errorf("step %s retries = %d, want %d", step.Name, *step.Retries, want[step.Name])
+		}
+	}
+}
+
+func TestShellCommandBlankShell(t *testing.T) {
+	for _, shell := range []string{"", "   ", "\t"} {
+		cmd := shellCommand(shell, "echo hi")
+		if len(cmd.Args) == 0 || cmd.Args[len(cmd.Args)-1] != "echo hi" {
+			t.Errorf("shellCommand(%q) args = %q", shell, cmd.Args)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// pkg/cache/cache.go
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+var ErrNotFound = errors.New("cache entry not found")
+
+// Store is a key-value store for build cache entries and artifacts. Keys are
+// slash-separated paths such as "<fingerprint>/entry.json".
+type Store interface {
+	// Get returns the content stored under key, or ErrNotFound
+	Get(key string) (io.ReadCloser, error)
+	Put(key string, content io.Reader) error
+}
+
+// NewStore returns an HTTPStore for http(s) URLs and a DirStore otherwise
+func NewStore(location string) (Store, error) {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return NewHTTPStore(location), nil
+	}
+	return NewDirStore(location)
+}
+
+func validateKey(key string) error {
+	if key == "" || path.IsAbs(key) || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return fmt.Errorf("invalid cache key %q", key)
+	}
+	return nil
+}
+
+// MultiStore reads from the first store that has a key and writes to all of
+// them in order, e.g. a local directory in front of a shared HTTP cache. A
+// store that fails a write doesn't keep the others from getting it.
+type MultiStore []Store
+
+func (m MultiStore) Get(key string) (io.ReadCloser, error) {
+	for _, store := range m {
+		content, err := store.Get(key)
+		if err == nil {
+			return content, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m MultiStore) Put(key string, content io.Reader) error {
+	if len(m) == 1 {
+		return m[0].Put(key, content)
+	}
+
+	// Spool the content once so every store can read it from the start
+	tmp, err := ioutil.TempFile("", "buildy-cache-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	_, err = io.Copy(tmp, content)
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	for _, store := range m {
+		_, err = tmp.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		err = store.Put(key, tmp)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("error writing %s to %d of %d cache stores: %s", key, len(errs), len(m), strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// pkg/cache/cache_test.go
+package cache
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewStore(t *testing.T) {
+	for _, location := range []string{"http://cache.example.com", "https://cache.example.com/buildy"} {
+		store, err := NewStore(location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := store.(*HTTPStore); !ok {
+			t.Errorf("NewStore(%q) = %T, want *HTTPStore", location, store)
+		}
+	}
+
+	store, err := NewStore(filepath.Join(t.TempDir(), "shared"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.(*DirStore); !ok {
+		t.Errorf("NewStore(dir) = %T, want *DirStore", store)
+	}
+}
+
+func TestMultiStore(t *testing.T) {
+	local, _ := NewDirStore(filepath.Join(t.TempDir(), "local"))
+	shared, _ := NewDirStore(filepath.Join(t.TempDir(), "shared"))
+	multi := MultiStore{local, shared}
+
+	// Reads fall through to the next store
+	if err := shared.Put("abc/entry.json", strings.NewReader("shared")); err != nil {
+		t.Fatal(err)
+	}
+	content, err := multi.Get("abc/entry.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(content)
+	content.Close()
+	if string(data) != "shared" {
+		t.Errorf("Get = %q, want shared", data)
+	}
+
+	if _, err := multi.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing key = %v, want ErrNotFound", err)
+	}
+
+	// Writes go to every store
+	if err := multi.Put("def/entry.json", strings.NewReader("both")); err != nil {
+		t.Fatal(err)
+	}
+	for _, store := range []*DirStore{local, shared} {
+		content, err := store.Get("def/entry.json")
+		if err != nil {
+			t.Fatalf("%s: %v", store.Root, err)
+		}
+		data, _ := ioutil.ReadAll(content)
+		content.Close()
+		if string(data) != "both" {
+			t.Errorf("%s: Get = %q, want both", store.Root, data)
+		}
+	}
+}
+
+// failingStore is a cache that can't be reached
+type failingStore struct{}
+
+func (failingStore) Get(key string) (io.ReadCloser, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (failingStore) Put(key string, content io.Reader) error {
+	return errors.New("connection refused")
+}
+
+func TestMultiStorePutFailure(t *testing.T) {
+	local, _ := NewDirStore(filepath.Join(t.TempDir(), "local"))
+	other, _ := NewDirStore(filepath.Join(t.TempDir(), "other"))
+
+	// A failing store, wherever it is, doesn't keep the others from the write
+	for _, multi := range []MultiStore{{local, failingStore{}, other}, {failingStore{}, local, other}} {
+		err := multi.Put("abc/entry.json", strings.NewReader("content"))
+		if err == nil || !strings.Contains(err.Error(), "1 of 3 cache stores: connection refused") {
+			t.Errorf("Put error = %v", err)
+		}
+		for _, store := range []*DirStore{local, other} {
+			content, err := store.Get("abc/entry.json")
+			if err != nil {
+				t.Fatalf("%s: %v", store.Root, err)
+			}
+			data, _ := ioutil.ReadAll(content)
+			content.Close()
+			if string(data) != "content" {
+				t.Errorf("%s: Get = %q, want content", store.Root, data)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// pkg/cache/dir.go
+package cache
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// DirStore keeps cache entries as files under a local directory
+type DirStore struct {
+	Root string
+}
+
+func NewDirStore(root string) (*DirStore, error) {
+	err := os.MkdirAll(root, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cache directory: %v", err)
+	}
+	return &DirStore{Root: root}, nil
+}
+
+func (d *DirStore) Get(key string) (io.ReadCloser, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filepath.Join(d.Root, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading cache entry %s: %v", key, err)
+	}
+	return file, nil
+}
+
+// Put writes to a temporary file first so a concurrent Get never sees a
+// partially written entry.
+func (d *DirStore) Put(key string, content io.Reader) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	dest := filepath.Join(d.Root, filepath.FromSlash(key))
+	err := os.MkdirAll(filepath.Dir(dest), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("error creating cache directory: %v", err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(dest), ".tmp-")
+	if err != nil {
+		return fmt.Errorf("error writing cache entry %s: %v", key, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing cache entry %s: %v", key, err)
+	}
+
+	err = os.Rename(tmp.Name(), dest)
+	if err != nil {
+		return fmt.Errorf("error writing cache entry %s: %v", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// pkg/cache/dir_test.go
+package cache
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDirStoreGetPut(t *testing.T) {
+	store, err := NewDirStore(filepath.Join(t.TempDir(), "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.Put("abc/artifacts/bin/app", strings.NewReader("binary"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := store.Get("abc/artifacts/bin/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer content.Close()
+	data, _ := ioutil.ReadAll(content)
+	if string(data) != "binary" {
+		t.Errorf("Get = %q, want binary", data)
+	}
+
+	// No temporary files are left behind
+	files, _ := ioutil.ReadDir(filepath.Join(store.Root, "abc", "artifacts", "bin"))
+	if len(files) != 1 {
+		t.Errorf("%d files in the entry directory, want 1", len(files))
+	}
+
+	if _, err := store.Get("abc/missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing key = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDirStoreRejectsInvalidKeys(t *testing.T) {
+	parent := t.TempDir()
+	store, err := NewDirStore(filepath.Join(parent, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"", "../x", "..", "/abs/x", "a/../../x", "a/../b", "./a", "a//b"} {
+		if err := store.Put(key, strings.NewReader("x")); err == nil {
+			t.Errorf("Put(%q) succeeded, want an error", key)
+		}
+		if _, err := store.Get(key); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) = %v, want an invalid key error", key, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(parent, "x")); !os.IsNotExist(err) {
+		t.Error("a key escaped the cache directory")
+	}
+}
+
+func TestValidateKey(t *testing.T) {
+	for _, key := range []string{"abc/entry.json", "abc/artifacts/dist/app.tar.gz", "a..b/c"} {
+		if err := validateKey(key); err != nil {
+			t.Errorf("validateKey(%q) = %v, want nil", key, err)
+		}
+	}
+}
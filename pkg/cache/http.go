@@ -0,0 +1,89 @@
+// pkg/cache/http.go
+package cache
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// HTTPStore talks to a remote cache that serves GET and accepts PUT for
+// <BaseURL>/<key>, answering 404 for missing keys.
+type HTTPStore struct {
+	BaseURL string
+	Client  *http.Client
+
+	// Token is sent as a bearer token when set
+	Token string
+}
+
+// NewHTTPStore returns a store for baseURL, authenticating with
+// BUILDY_CACHE_TOKEN from the environment if it is set.
+func NewHTTPStore(baseURL string) *HTTPStore {
+	return &HTTPStore{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Client:  &http.Client{Timeout: 5 * time.Minute},
+		Token:   os.Getenv("BUILDY_CACHE_TOKEN"),
+	}
+}
+
+func (h *HTTPStore) Get(key string) (io.ReadCloser, error) {
+	req, err := h.newRequest(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching cache entry %s: %v", key, err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("error fetching cache entry %s: %s", key, resp.Status)
+	}
+}
+
+func (h *HTTPStore) Put(key string, content io.Reader) error {
+	req, err := h.newRequest(http.MethodPut, key, content)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error storing cache entry %s: %v", key, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("error storing cache entry %s: %s", key, resp.Status)
+	}
+	return nil
+}
+
+func (h *HTTPStore) newRequest(method, key string, body io.Reader) (*http.Request, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, h.BaseURL+"/"+key, body)
+	if err != nil {
+		return nil, err
+	}
+	if h.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.Token)
+	}
+	return req, nil
+}
@@ -0,0 +1,117 @@
+// pkg/cache/http_test.go
+package cache
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memoryServer is a minimal remote cache keeping entries in memory
+type memoryServer struct {
+	mu      sync.Mutex
+	entries map[string]string
+	auth    []string
+}
+
+func (m *memoryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.auth = append(m.auth, r.Header.Get("Authorization"))
+
+	switch r.Method {
+	case http.MethodGet:
+		content, ok := m.entries[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	case http.MethodPut:
+		data, _ := ioutil.ReadAll(r.Body)
+		m.entries[r.URL.Path] = string(data)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHTTPStoreGetPut(t *testing.T) {
+	server := &memoryServer{entries: make(map[string]string)}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	store := NewHTTPStore(ts.URL + "/cache/")
+	store.Token = "secret"
+
+	err := store.Put("abc/entry.json", strings.NewReader(`{"fingerprint":"abc"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := server.entries["/cache/abc/entry.json"]; !ok {
+		t.Fatalf("entry stored under %v, want /cache/abc/entry.json", server.entries)
+	}
+
+	content, err := store.Get("abc/entry.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer content.Close()
+	data, _ := ioutil.ReadAll(content)
+	if string(data) != `{"fingerprint":"abc"}` {
+		t.Errorf("Get = %q", data)
+	}
+
+	for _, auth := range server.auth {
+		if auth != "Bearer secret" {
+			t.Errorf("Authorization = %q, want Bearer secret", auth)
+		}
+	}
+}
+
+func TestHTTPStoreNotFound(t *testing.T) {
+	ts := httptest.NewServer(&memoryServer{entries: make(map[string]string)})
+	defer ts.Close()
+
+	_, err := NewHTTPStore(ts.URL).Get("missing/entry.json")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of a missing key = %v, want ErrNotFound", err)
+	}
+}
+
+func TestHTTPStoreErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	store := NewHTTPStore(ts.URL)
+
+	_, err := store.Get("abc/entry.json")
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get on a 503 = %v, want an error other than ErrNotFound", err)
+	}
+	if err := store.Put("abc/entry.json", strings.NewReader("{}")); err == nil {
+		t.Error("Put on a 503 succeeded, want an error")
+	}
+}
+
+func TestHTTPStoreRejectsInvalidKeys(t *testing.T) {
+	server := &memoryServer{entries: make(map[string]string)}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	store := NewHTTPStore(ts.URL)
+
+	if _, err := store.Get("../x"); err == nil {
+		t.Error("Get(../x) succeeded, want an error")
+	}
+	if err := store.Put("../x", strings.NewReader("")); err == nil {
+		t.Error("Put(../x) succeeded, want an error")
+	}
+	if len(server.auth) != 0 {
+		t.Errorf("%d requests sent for invalid keys, want none", len(server.auth))
+	}
+}
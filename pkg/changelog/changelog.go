@@ -2,9 +2,7 @@
 package changelog
 
 import (
-	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -13,371 +11,433 @@ import (
 
 	"buildy/pkg/config"
 
-	"github.com/go-git/go-git/plumbing/storer"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
-func GenerateChangelogs(cfg *config.Config, outputDir string) error {
-	// Open the main Git repository
-	mainRepo, err := git.PlainOpen(".")
+// generator holds what changelog entries are selected and rendered with
+type generator struct {
+	cfg       *config.Config
+	rules     *rules
+	templates templates
+	// formats are the formats changelogs are written in
+	formats []string
+}
+
+func newGenerator(cfg *config.Config) (*generator, error) {
+	rules, err := newRules(cfg.Changelog)
 	if err != nil {
-		return fmt.Errorf("error opening main Git repository: %v", err)
+		return nil, err
 	}
 
-	// Read the centralized changelog file
-	centralizedChangelogFile := filepath.Join(outputDir, "CHANGELOG.md")
-	lastSubProjectCommits, err := getLastSubProjectCommitsFromChangelog(centralizedChangelogFile)
+	formats := cfg.Changelog.Formats
+	if len(formats) == 0 {
+		formats = []string{FormatMarkdown}
+	}
+	err = ValidateFormats(formats)
 	if err != nil {
-		return fmt.Errorf("error getting last subproject commits from centralized changelog: %v", err)
+		return nil, err
 	}
 
-	// Create a slice to store the subproject commits in the correct order
-	subProjectCommits := make([]string, len(cfg.SubProjects))
-
-	// Generate changelog for each subproject
-	for i, subProject := range cfg.SubProjects {
-		subProjectDir := filepath.Join(subProject.Path)
+	return &generator{cfg: cfg, rules: rules, templates: make(templates), formats: formats}, nil
+}
 
-		// Check if the subproject has its own Git repository
-		subProjectRepo, err := git.PlainOpen(subProjectDir)
-		if err != nil {
-			// If the subproject doesn't have its own repository, use the main repository
-			subProjectRepo = mainRepo
-		}
+// Changes counts the commits since each changelog's checkpoint
+type Changes struct {
+	SubProjects map[string]int
+	Central     int
+}
 
-		// Get the last checked commit for the subproject from the centralized changelog
-		lastSubProjectCommit := lastSubProjectCommits[subProject.Name]
+// PendingChanges counts the commits the next changelog entries would cover,
+// so that only projects with new commits get a new version. Commits that
+// only touch the files buildy generates, like the commit of a release,
+// don't count.
+func PendingChanges(cfg *config.Config, outputDir string) (*Changes, error) {
+	mainRepo, err := git.PlainOpen(".")
+	if err != nil {
+		return nil, fmt.Errorf("error opening main Git repository: %v", err)
+	}
 
-		// Get the latest commit from the subproject repository
-		latestSubProjectCommit, err := getLatestCommit(subProjectRepo)
+	st, err := loadState(filepath.Join(outputDir, StateFile), filepath.Join(outputDir, "CHANGELOG.md"))
+	if err != nil {
+		return nil, err
+	}
 
+	changes := &Changes{SubProjects: make(map[string]int)}
+	for _, subProject := range cfg.SubProjects {
+		repo, paths, err := subProjectSource(mainRepo, subProject)
 		if err != nil {
-			return fmt.Errorf("error getting latest commit for subproject %s: %v", subProject.Name, err)
+			return nil, err
 		}
-
-		// If no commits are saved in the centralized changelog, get the first commit from the subproject repository
-		if len(lastSubProjectCommit) == 0 {
-			firstSubProjectCommit, err := getFirstCommit(subProjectRepo)
-			if err != nil {
-				return fmt.Errorf("error getting first commit for subproject %s: %v", subProject.Name, err)
-			}
-			lastSubProjectCommit = firstSubProjectCommit
+		paths, err = paths.ignoreGenerated(repo, cfg, outputDir)
+		if err != nil {
+			return nil, err
 		}
-
-		// Store the latest subproject commit in the slice
-		subProjectCommits[i] = latestSubProjectCommit
-
-		// Generate the subproject changelog
-		err = generateSubProjectChangelog(subProject, subProjectDir, subProjectRepo, lastSubProjectCommit, latestSubProjectCommit)
+		commits, _, err := newCommits(repo, paths, st.SubProjects[subProject.Name].Commit)
 		if err != nil {
-			return fmt.Errorf("error generating changelog for subproject %s: %v", subProject.Name, err)
+			return nil, fmt.Errorf("error getting commits for subproject %s: %v", subProject.Name, err)
 		}
+		changes.SubProjects[subProject.Name] = len(commits)
 	}
 
-	// Update the centralized changelog
-	err = updateCentralizedChangelog(centralizedChangelogFile, cfg.SubProjects, mainRepo, cfg.Version, subProjectCommits, cfg.Name)
+	var lastCentral string
+	if st.Central != nil {
+		lastCentral = st.Central.Commit
+	}
+	paths, err := newPathFilter().ignoreGenerated(mainRepo, cfg, outputDir)
 	if err != nil {
-		return fmt.Errorf("error updating centralized changelog: %v", err)
+		return nil, err
 	}
-	return nil
+	commits, _, err := newCommits(mainRepo, paths, lastCentral)
+	if err != nil {
+		return nil, fmt.Errorf("error getting commits for central project %s: %v", cfg.Name, err)
+	}
+	changes.Central = len(commits)
+
+	return changes, nil
 }
 
-func updateCentralizedChangelog(changelogFile string, subProjects []config.SubProject, repo *git.Repository, centralVersion string, subProjectCommits []string, centralName string) error {
-	// Read the existing changelog content
-	content, _ := ioutil.ReadFile(changelogFile)
-
-	// Get the current date
-	currentDate := time.Now().Format("2006-01-02")
-
-	// Generate the new changelog entry
-	entry := fmt.Sprintf("## [%s] - %s\n\n", centralVersion, currentDate)
-	for i, subProject := range subProjects {
-		entry += fmt.Sprintf("### %s\n", subProject.Name)
-		if subProjectCommits[i] != "" {
-			entry += fmt.Sprintf("- Updated to version %s | %s\n", subProject.Version, subProjectCommits[i])
-		} else {
-			entry += fmt.Sprintf("- Updated to version %s\n", subProject.Version)
-		}
+// GenerateChangelogs updates each subproject's changelog and the centralized
+// one, and returns the entries added to the subproject changelogs by name.
+// Only the released subprojects, mapped to the version they were released
+// from, get an entry. Changelogs of the others,
+// without new commits or with an entry for the current version already,
+// are left as they are and keep their checkpoint, so their commits go into
+// their next entry.
+func GenerateChangelogs(cfg *config.Config, outputDir string, released map[string]string) (map[string]string, error) {
+	g, err := newGenerator(cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	// Get the latest commit from the main repository
-	latestCentralCommit, err := getLatestCommit(repo)
+	// Open the main Git repository
+	mainRepo, err := git.PlainOpen(".")
 	if err != nil {
-		return fmt.Errorf("error getting latest commit: %v", err)
+		return nil, fmt.Errorf("error opening main Git repository: %v", err)
 	}
 
-	lastCommit, err := getLastCentralCommitsFromChangelog(changelogFile, repo)
+	err = os.MkdirAll(outputDir, os.ModePerm)
 	if err != nil {
-		return fmt.Errorf("error getting commits for central repository: %v", err)
+		return nil, fmt.Errorf("error creating output directory: %v", err)
 	}
 
-	// Get the commits between the last subproject commit and the latest central commit
-	centralCommits, err := getCommitsBetween(repo, lastCommit, latestCentralCommit)
+	// Read the commits the changelogs were last generated at
+	centralizedChangelogFile := filepath.Join(outputDir, "CHANGELOG.md")
+	stateFile := filepath.Join(outputDir, StateFile)
+	st, err := loadState(stateFile, centralizedChangelogFile)
 	if err != nil {
-		return fmt.Errorf("error getting commits for central project %s: %v", centralName, err)
+		return nil, err
 	}
+	now := time.Now()
 
-	// Add the central repository commits to the changelog entry
-	if len(centralCommits) > 0 {
-		entry += "\n### Central Repository\n"
-		for _, commit := range centralCommits {
-			entry += fmt.Sprintf("- %s\n", commit.Message)
+	// The subprojects that got a new entry, listed in the central one
+	var updated []SubProjectRelease
+	entries := make(map[string]string)
+
+	// Generate changelog for each subproject
+	for _, subProject := range cfg.SubProjects {
+		previousVersion, ok := released[subProject.Name]
+		if !ok {
+			continue
+		}
+		subProjectDir := filepath.Join(subProject.Path)
+		subProjectRepo, paths, err := subProjectSource(mainRepo, subProject)
+		if err != nil {
+			return nil, err
+		}
+		paths, err = paths.ignoreGenerated(subProjectRepo, cfg, outputDir)
+		if err != nil {
+			return nil, err
 		}
-	}
 
-	commitObj, err := getCommitByHash(repo, latestCentralCommit)
-	// Generate the commit information
-	var commitInfo string
-	if latestCentralCommit != "" {
-		commitInfo = fmt.Sprintf("Commit: %s\n", latestCentralCommit)
-		commitInfo += fmt.Sprintf("Author: %s\n", &commitObj.Author)
-		commitInfo += fmt.Sprintf("Date: %s\n", commitObj.Author.When)
-		commitInfo += fmt.Sprintf("Message: %s\n", commitObj.Message)
-	} else {
-		// Use default values if no commit data is found
-		buildNumber := os.Getenv("BUILD_NUMBER")
-		if buildNumber == "" {
-			buildNumber = "Unknown"
+		// Get the commits since the last checked commit for the subproject,
+		// or since the beginning of its history
+		last := st.SubProjects[subProject.Name]
+		commits, latestSubProjectCommit, err := newCommits(subProjectRepo, paths, last.Commit)
+		if err != nil {
+			return nil, fmt.Errorf("error getting commits for subproject %s: %v", subProject.Name, err)
+		}
+		if len(commits) == 0 {
+			continue
 		}
-		hostname, _ := os.Hostname()
-		commitInfo = fmt.Sprintf("Commit: %s\n", buildNumber)
-		commitInfo += fmt.Sprintf("Author: %s\n", hostname)
-		commitInfo += fmt.Sprintf("Date: %s\n", currentDate)
-		commitInfo += "Message: Build Message <Recommend>\n"
-	}
 
-	// Combine the entry with the existing content
-	updatedContent := fmt.Sprintf("%s\n%s\n%s", entry, commitInfo, string(content))
+		// Generate the subproject changelog
+		release, entry, err := g.generateSubProjectChangelog(subProject, subProjectDir, last, commits, latestSubProjectCommit)
+		if err != nil {
+			return nil, fmt.Errorf("error generating changelog for subproject %s: %v", subProject.Name, err)
+		}
+		if release == nil {
+			continue
+		}
+		entries[subProject.Name] = entry
+		st.SubProjects[subProject.Name] = last.advance(subProject.Version, latestSubProjectCommit, now)
+		subProjectRelease := SubProjectRelease{
+			Name:            subProject.Name,
+			Version:         subProject.Version,
+			PreviousVersion: previousVersion,
+			Commit:          latestSubProjectCommit,
+		}
+		if cfg.Changelog.Aggregate {
+			subProjectRelease.Changes = release
+		}
+		updated = append(updated, subProjectRelease)
+	}
 
-	// Write the updated content back to the changelog file
-	err = ioutil.WriteFile(changelogFile, []byte(updatedContent), 0644)
+	// Update the centralized changelog
+	var central checkpoint
+	if st.Central != nil {
+		central = *st.Central
+	}
+	centralCommit, err := g.updateCentralizedChangelog(outputDir, mainRepo, central, updated)
 	if err != nil {
-		return fmt.Errorf("error writing centralized changelog file: %v", err)
+		return nil, fmt.Errorf("error updating centralized changelog: %v", err)
+	}
+	if centralCommit != "" {
+		central = central.advance(cfg.Version, centralCommit, now)
+		st.Central = &central
 	}
 
-	return nil
-}
-
-func generateSubProjectChangelog(subProject config.SubProject, subProjectDir string, repo *git.Repository, lastSubProjectCommit, latestSubProjectCommit string) error {
-	changelogFile := filepath.Join(subProjectDir, "CHANGELOG.md")
-
-	// Create the directory if it doesn't exist
-	err := os.MkdirAll(filepath.Dir(changelogFile), os.ModePerm)
+	err = st.save(stateFile)
 	if err != nil {
-		return fmt.Errorf("error creating directory for subproject changelog: %v", err)
+		return nil, err
 	}
+	return entries, nil
+}
 
-	// Get the commits between the last subproject commit and the latest central commit
-	commits, err := getCommitsBetween(repo, lastSubProjectCommit, latestSubProjectCommit)
+// subProjectSource returns the repository a subproject's history is read
+// from and the paths its commits have to touch, relative to its worktree
+func subProjectSource(mainRepo *git.Repository, subProject config.SubProject) (*git.Repository, pathFilter, error) {
+	// Check if the subproject has its own Git repository
+	repo, err := git.PlainOpen(filepath.Join(subProject.Path))
 	if err != nil {
-		return fmt.Errorf("error getting commits for subproject %s: %v", subProject.Name, err)
-	}
-
-	// Generate the changelog entry for the subproject
-	var entry string
-	buildNumber := subProject.Version
-	if len(commits) > 0 {
-		latestCommit := commits[0]
-		timestamp := latestCommit.Author.When.Format("2006-01-02")
-		entry = fmt.Sprintf("## [%s] - %s\n", buildNumber, timestamp)
-		for _, commit := range commits {
-			entry += fmt.Sprintf("- %s\n", commit.Message)
-		}
+		// If the subproject doesn't have its own repository, use the main
+		// repository but only the commits that touch the subproject
+		repo = mainRepo
 	}
-
-	// Read the existing changelog content
-	content, _ := ioutil.ReadFile(changelogFile)
-
-	// Prepend the new entry to the existing content
-	updatedContent := fmt.Sprintf("%s\n%s", entry, string(content))
-
-	// Write the updated content back to the changelog file
-	err = ioutil.WriteFile(changelogFile, []byte(updatedContent), 0644)
+	root, err := worktreeRoot(repo)
 	if err != nil {
-		return fmt.Errorf("error writing subproject changelog file: %v", err)
+		return nil, pathFilter{}, err
 	}
 
-	return nil
-}
-
-func getLastSubProjectCommitsFromChangelog(changelogFile string) (map[string]string, error) {
-	lastSubProjectCommits := make(map[string]string)
-
-	// Read the centralized changelog file
-	content, err := ioutil.ReadFile(changelogFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// If the file doesn't exist, return an empty map
-			return lastSubProjectCommits, nil
+	var paths []string
+	if repo == mainRepo {
+		// The subproject path is relative to the current directory
+		p, err := relativeTo(root, subProject.Path)
+		if err != nil {
+			return nil, pathFilter{}, fmt.Errorf("subproject %s: %v", subProject.Name, err)
 		}
-		return nil, fmt.Errorf("error reading centralized changelog file: %v", err)
-	}
-	// Parse the last subproject commit hashes from the changelog
-	lines := strings.Split(string(content), "\n")
-	subProjects := make([]string, 0)
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "### ") && !strings.Contains(line, "`### Central Repository`") {
-			subProject := strings.TrimSpace(line[4:])
-			subProjects = append(subProjects, subProject)
-		} else if strings.HasPrefix(line, "- Updated to version") {
-			parts := strings.Split(line, "|")
-			if len(parts) == 2 && len(subProjects) > 0 {
-				commitHash := strings.TrimSpace(parts[1])
-				subProject := subProjects[len(subProjects)-1]
-				lastSubProjectCommits[subProject] = commitHash
+		paths = append(paths, p)
+	}
+	for _, p := range subProject.ChangelogPaths {
+		if filepath.IsAbs(p) {
+			p, err = relativeTo(root, p)
+			if err != nil {
+				return nil, pathFilter{}, fmt.Errorf("subproject %s: %v", subProject.Name, err)
 			}
-		} else if line == "#### `### Central Repository`" {
-			break
 		}
+		paths = append(paths, p)
 	}
+	return repo, newPathFilter(paths...), nil
+}
 
-	return lastSubProjectCommits, nil
+// newCommits returns the commits since last that touch paths, and the
+// latest commit they lead up to
+func newCommits(repo *git.Repository, paths pathFilter, last string) ([]*object.Commit, string, error) {
+	latest, err := getLatestCommit(repo)
+	if err != nil {
+		return nil, "", fmt.Errorf("error getting latest commit: %v", err)
+	}
+	commits, err := commitRange(repo, last, latest)
+	if err != nil {
+		return nil, "", err
+	}
+	commits, err = paths.filter(commits)
+	if err != nil {
+		return nil, "", fmt.Errorf("error filtering commits: %v", err)
+	}
+	return commits, latest, nil
 }
 
-func getLastCentralCommitsFromChangelog(changelogFile string, centralProjectRepo *git.Repository) (string, error) {
-	var lastCommit string
-	// Read the centralized changelog file
-	content, err := ioutil.ReadFile(changelogFile)
+// HasEntry reports whether the changelog of a subproject, or of the central
+// project if project is empty, already has an entry for version. A project
+// isn't released as a version its changelog has, since it wouldn't get an
+// entry.
+func HasEntry(cfg *config.Config, outputDir, project, version string) (bool, error) {
+	g, err := newGenerator(cfg)
 	if err != nil {
-		if os.IsNotExist(err) {
-			// If the file doesn't exist, return the first repo commit
-			firstSubProjectCommit, err := getFirstCommit(centralProjectRepo)
-			if err != nil {
-				return "", fmt.Errorf("error getting first commit for centralProject %s", err)
-			}
-			return firstSubProjectCommit, nil
-		}
-		return "", fmt.Errorf("error reading centralized changelog file: %v", err)
-	}
-	// Parse the last subproject commit hashes from the changelog
-	lines := strings.Split(string(content), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "Commit: ") {
-			lastCommit = strings.TrimSpace(line[7:])
-			return lastCommit, nil
+		return false, err
+	}
+	st, err := loadState(filepath.Join(outputDir, StateFile), filepath.Join(outputDir, files[FormatMarkdown]))
+	if err != nil {
+		return false, err
+	}
+
+	if project == "" {
+		var last checkpoint
+		if st.Central != nil {
+			last = *st.Central
 		}
+		return g.hasEntry(last, outputDir, version), nil
+	}
+	subProject := cfg.GetSubProject(project)
+	if subProject == nil {
+		return false, fmt.Errorf("subproject %s not found in configuration", project)
 	}
-	return "", nil
+	return g.hasEntry(st.SubProjects[project], subProject.Path, version), nil
 }
 
-func getCommitsBetween(repo *git.Repository, oldCommit, newCommit string) ([]*object.Commit, error) {
-	var commits []*object.Commit
-	var collecting bool
+// hasEntry reports whether the changelogs in dir already have an entry for
+// version, recorded in their checkpoint or in the changelog of any of the
+// configured formats
+func (g *generator) hasEntry(last checkpoint, dir, version string) bool {
+	if _, ok := last.find(version); ok {
+		return true
+	}
+	for _, format := range g.formats {
+		content, _ := ioutil.ReadFile(filepath.Join(dir, files[format]))
+		if hasVersion(format, content, version) {
+			return true
+		}
+	}
+	return false
+}
 
-	// Start log from the beginning since no specific starting point is provided
-	iter, err := repo.Log(&git.LogOptions{})
+// updateCentralizedChangelog adds an entry for the central project listing
+// the updated subprojects, and returns the central commit it covers changes
+// up to. Without new commits or updated subprojects, or with an entry for
+// the version already there, nothing is written and the commit is empty.
+func (g *generator) updateCentralizedChangelog(outputDir string, repo *git.Repository, last checkpoint, updated []SubProjectRelease) (string, error) {
+	// Get the commits since the last central commit, or since the
+	// beginning of the history without a checkpoint
+	paths, err := newPathFilter().ignoreGenerated(repo, g.cfg, outputDir)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	centralCommits, latestCentralCommit, err := newCommits(repo, paths, last.Commit)
+	if err != nil {
+		return "", fmt.Errorf("error getting commits for central project %s: %v", g.cfg.Name, err)
+	}
+	if len(centralCommits) == 0 && len(updated) == 0 {
+		return "", nil
+	}
+	if g.hasEntry(last, outputDir, g.cfg.Version) {
+		return "", nil
 	}
-	defer iter.Close()
 
-	// Iterate over commits from newest to oldest
-	err = iter.ForEach(func(commit *object.Commit) error {
+	release := CentralRelease{SubProjects: updated, Aggregate: g.cfg.Changelog.Aggregate}
+	commits := parseCommits(centralCommits)
+	if release.Aggregate {
+		commits = withoutSubProjectCommits(commits, updated)
+	}
+	release.Release = newRelease(g.cfg.Name, g.cfg.Version, time.Now(), last.Commit, latestCentralCommit, commits, g.rules)
 
-		// Start collecting commits if newCommit is found
-		if commit.Hash.String() == newCommit {
-			collecting = true
+	// Record the commit this entry was generated at
+	commitObj, err := getCommitByHash(repo, latestCentralCommit)
+	if err == nil {
+		release.Checkpoint = Checkpoint{
+			Hash:    latestCentralCommit,
+			Author:  commitObj.Author.String(),
+			Date:    commitObj.Author.When.String(),
+			Message: strings.SplitN(strings.TrimSpace(commitObj.Message), "\n", 2)[0],
 		}
-
-		// Collect commits if we are within the range
-		if collecting {
-			commits = append(commits, commit)
+	} else {
+		// Use default values if no commit data is found
+		buildNumber := os.Getenv("BUILD_NUMBER")
+		if buildNumber == "" {
+			buildNumber = "Unknown"
 		}
-
-		// Stop collecting when oldCommit is found
-		if commit.Hash.String() == oldCommit && collecting {
-			return storer.ErrStop // Stop after adding oldCommit
+		hostname, _ := os.Hostname()
+		release.Checkpoint = Checkpoint{
+			Hash:    buildNumber,
+			Author:  hostname,
+			Date:    release.Date.Format("2006-01-02"),
+			Message: "Build Message <Recommend>",
 		}
-
-		return nil
-	})
-	if err != nil && err != storer.ErrStop {
-		return nil, err
 	}
 
-	// Verify if the required commits were collected
-	if len(commits) == 0 || commits[len(commits)-1].Hash.String() != oldCommit {
-		return nil, fmt.Errorf("could not find a valid range between %s and %s", newCommit, oldCommit)
+	tmpl, err := g.templates.load(g.cfg.Changelog.CentralTemplate, centralTemplate)
+	if err != nil {
+		return "", err
 	}
-
-	return commits, nil
-}
-
-func getFirstCommit(repo *git.Repository) (string, error) {
-	iter, err := repo.Log(&git.LogOptions{Order: git.LogOrderCommitterTime})
+	err = g.writeEntry(outputDir, release, tmpl)
 	if err != nil {
 		return "", err
 	}
-	defer iter.Close()
 
-	var firstCommit *object.Commit
-	// Iterate through all commits and keep the last one in the iteration
-	for {
-		commit, err := iter.Next()
-		if err == io.EOF {
-			break
+	return latestCentralCommit, nil
+}
+
+// withoutSubProjectCommits leaves out the commits an aggregated entry
+// already lists under a subproject
+func withoutSubProjectCommits(commits []Commit, subProjects []SubProjectRelease) []Commit {
+	listed := make(map[string]bool)
+	for _, subProject := range subProjects {
+		if subProject.Changes == nil {
+			continue
 		}
-		if err != nil {
-			return "", err
+		for _, c := range subProject.Changes.Commits {
+			listed[c.Hash] = true
 		}
-		firstCommit = commit
 	}
 
-	if firstCommit == nil {
-		return "", errors.New("repository does not contain any commits")
+	var kept []Commit
+	for _, c := range commits {
+		if !listed[c.Hash] {
+			kept = append(kept, c)
+		}
 	}
-
-	return firstCommit.Hash.String(), nil
+	return kept
 }
 
-func getLatestCommit(repo *git.Repository) (string, error) {
-	iter, err := repo.Log(&git.LogOptions{Order: git.LogOrderCommitterTime})
+// generateSubProjectChangelog prepends an entry for the subproject's
+// version listing commits, and returns its release and the entry. It
+// returns no release without writing anything if the changelog has an
+// entry for the version already.
+func (g *generator) generateSubProjectChangelog(subProject config.SubProject, subProjectDir string, last checkpoint, commits []*object.Commit, latestSubProjectCommit string) (*Release, string, error) {
+	// Create the directory if it doesn't exist
+	err := os.MkdirAll(subProjectDir, os.ModePerm)
 	if err != nil {
-		return "", err
+		return nil, "", fmt.Errorf("error creating directory for subproject changelog: %v", err)
 	}
-	defer iter.Close()
 
-	var firstCommit *object.Commit
-	err = iter.ForEach(func(commit *object.Commit) error {
-		firstCommit = commit
-		return storer.ErrStop
-	})
-	if err != nil && err != storer.ErrStop {
-		return "", err
+	if g.hasEntry(last, subProjectDir, subProject.Version) {
+		return nil, "", nil
 	}
 
-	return firstCommit.Hash.String(), nil
-}
-
-func getCommitsUpTo(repo *git.Repository, latestCommit string) ([]*object.Commit, error) {
-	var commits []*object.Commit
-
-	hash, err := stringToHash(latestCommit)
+	// Generate the changelog entry for the subproject, with the subproject's
+	// own template if it has one
+	templatePath := subProject.ChangelogTemplate
+	if templatePath == "" {
+		templatePath = g.cfg.Changelog.Template
+	}
+	tmpl, err := g.templates.load(templatePath, subProjectTemplate)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	// Create a new commit iterator
-	iter, err := repo.Log(&git.LogOptions{From: hash})
+	latestCommit := commits[0]
+	release := newRelease(subProject.Name, subProject.Version, latestCommit.Author.When, last.Commit, latestSubProjectCommit, parseCommits(commits), g.rules)
+	entry, err := render(tmpl, release)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	defer iter.Close()
 
-	// Iterate through the commits up to the latest commit
-	err = iter.ForEach(func(commit *object.Commit) error {
-		commits = append(commits, commit)
-		return nil
-	})
+	err = g.writeEntry(subProjectDir, release, tmpl)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	return commits, nil
+	return &release, entry, nil
+}
+
+// getLatestCommit returns the commit HEAD points to
+func getLatestCommit(repo *git.Repository) (string, error) {
+	head, err := repo.Head()
+	if err != nil {
+		return "", err
+	}
+	return head.Hash().String(), nil
 }
 
 func stringToHash(hashString string) (plumbing.Hash, error) {
@@ -0,0 +1,238 @@
+// pkg/changelog/changelog_test.go
+package changelog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"buildy/pkg/config"
+)
+
+func testConfig() *config.Config {
+	return &config.Config{
+		Name:    "platform",
+		Version: "1.0.0",
+		File:    "buildy.yaml",
+		SubProjects: []config.SubProject{
+			{Name: "a", Version: "1.0.0", Path: "svc/a"},
+			{Name: "b", Version: "1.0.0", Path: "svc/b"},
+		},
+	}
+}
+
+// commitFiles commits the current content of files, as a release would
+func (r *testRepo) commitFiles(message string, names ...string) {
+	r.t.Helper()
+	files := make(map[string]string)
+	for _, name := range names {
+		data, err := ioutil.ReadFile(filepath.Join(r.dir, name))
+		if err != nil {
+			r.t.Fatal(err)
+		}
+		files[name] = string(data)
+	}
+	r.commit(message, files)
+}
+
+func pendingChanges(t *testing.T, cfg *config.Config) *Changes {
+	t.Helper()
+	changes, err := PendingChanges(cfg, "reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return changes
+}
+
+func TestPendingChangesIgnoresGeneratedFiles(t *testing.T) {
+	r := newTestRepo(t)
+	r.commit("chore: add config", map[string]string{"buildy.yaml": "name: platform\n"})
+	r.commit("feat: add a", map[string]string{"svc/a/main.go": "a"})
+	r.commit("feat: add b", map[string]string{"svc/b/main.go": "b"})
+	chdir(t, r.dir)
+
+	cfg := testConfig()
+	changes := pendingChanges(t, cfg)
+	// The configuration file is generated, as versions are written back to it
+	if changes.SubProjects["a"] != 1 || changes.SubProjects["b"] != 1 || changes.Central != 2 {
+		t.Fatalf("pending changes before the release = %+v", changes)
+	}
+
+	cfg.Changelog.Formats = []string{FormatMarkdown, FormatJSON}
+	released := map[string]string{"a": "1.0.0", "b": "1.0.0"}
+	cfg.SubProjects[0].Version, cfg.SubProjects[1].Version, cfg.Version = "1.0.1", "1.0.1", "1.0.1"
+	if _, err := GenerateChangelogs(cfg, "reports", released); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("buildy.yaml", []byte("name: platform\nversion: 1.0.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("reports/history.jsonl", []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r.commitFiles("chore: release",
+		"buildy.yaml", "reports/CHANGELOG.md", "reports/changelog.json", "reports/"+StateFile, "reports/history.jsonl",
+		"svc/a/CHANGELOG.md", "svc/a/changelog.json", "svc/b/CHANGELOG.md", "svc/b/changelog.json")
+
+	changes = pendingChanges(t, cfg)
+	if changes.SubProjects["a"] != 0 || changes.SubProjects["b"] != 0 || changes.Central != 0 {
+		t.Errorf("the release commit counts as a change: %+v", changes)
+	}
+
+	// A commit changing a generated file along with anything else counts
+	r.commit("fix: a", map[string]string{"svc/a/main.go": "a2", "svc/a/CHANGELOG.md": "edited"})
+	changes = pendingChanges(t, cfg)
+	if changes.SubProjects["a"] != 1 || changes.SubProjects["b"] != 0 || changes.Central != 1 {
+		t.Errorf("pending changes after a fix = %+v", changes)
+	}
+}
+
+func TestHasEntry(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	cfg := testConfig()
+	if err := os.MkdirAll("svc/a", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("svc/a/CHANGELOG.md", []byte("## [1.0.1] - 2024-05-01\n\n- change\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	st := &state{
+		Central:     &checkpoint{Releases: []release{{Version: "2.0.0", To: "abc"}}},
+		SubProjects: map[string]checkpoint{"b": {Releases: []release{{Version: "1.2.0", To: "def"}}}},
+	}
+	if err := os.MkdirAll("reports", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.save(filepath.Join("reports", StateFile)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		project, version string
+		want             bool
+	}{
+		{"a", "1.0.1", true},
+		{"a", "1.0.2", false},
+		{"b", "1.2.0", true},
+		{"b", "1.0.1", false},
+		{"", "2.0.0", true},
+		{"", "1.0.1", false},
+	}
+	for _, test := range tests {
+		got, err := HasEntry(cfg, "reports", test.project, test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("HasEntry(%q, %s) = %v, want %v", test.project, test.version, got, test.want)
+		}
+	}
+
+	if _, err := HasEntry(cfg, "reports", "c", "1.0.0"); err == nil {
+		t.Error("expected an error for an unknown subproject")
+	}
+
+	// Only the changelogs of the configured formats are read
+	if err := os.MkdirAll("svc/b", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("svc/b/changelog.json", []byte(`{"releases": [{"version": "1.3.0"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, formats := range [][]string{nil, {FormatJSON}} {
+		cfg.Changelog.Formats = formats
+		got, err := HasEntry(cfg, "reports", "b", "1.3.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := formats != nil; got != want {
+			t.Errorf("HasEntry(b, 1.3.0) with formats %q = %v, want %v", formats, got, want)
+		}
+	}
+}
+
+func TestWithoutSubProjectCommits(t *testing.T) {
+	commits := []Commit{{Hash: "1"}, {Hash: "2"}, {Hash: "3"}, {Hash: "4"}}
+	subProjects := []SubProjectRelease{
+		{Name: "a", Changes: &Release{Commits: []Commit{{Hash: "1"}, {Hash: "3"}}}},
+		// Not aggregated
+		{Name: "b"},
+		{Name: "c", Changes: &Release{Commits: []Commit{{Hash: "5"}}}},
+	}
+
+	var kept []string
+	for _, c := range withoutSubProjectCommits(commits, subProjects) {
+		kept = append(kept, c.Hash)
+	}
+	if want := []string{"2", "4"}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("withoutSubProjectCommits = %q, want %q", kept, want)
+	}
+}
+
+// centralEntry returns the subproject part and the central repository part
+// of the latest centralized changelog entry
+func centralEntry(t *testing.T) (string, string) {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("reports", "CHANGELOG.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := strings.SplitN(string(data), "\nCommit: ", 2)[0]
+	if i := strings.Index(entry, "### Central Repository"); i >= 0 {
+		return entry[:i], entry[i:]
+	}
+	return entry, ""
+}
+
+func TestGenerateAggregatedChangelog(t *testing.T) {
+	r := newTestRepo(t)
+	r.commit("docs: init", map[string]string{"README.md": "init"})
+	r.commit("feat: a one", map[string]string{"svc/a/main.go": "1"})
+	r.commit("feat: b one", map[string]string{"svc/b/main.go": "1"})
+	r.commit("fix: a and docs", map[string]string{"svc/a/main.go": "2", "README.md": "a"})
+	r.commit("docs: central only", map[string]string{"README.md": "central"})
+	chdir(t, r.dir)
+
+	cfg := testConfig()
+	cfg.Changelog.Aggregate = true
+	cfg.Version, cfg.SubProjects[0].Version, cfg.SubProjects[1].Version = "1.1.0", "1.1.0", "1.0.1"
+	if _, err := GenerateChangelogs(cfg, "reports", map[string]string{"a": "1.0.0", "b": "1.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	subProjects, central := centralEntry(t)
+	for _, want := range []string{"| a | 1.0.0 | 1.1.0 |", "| b | 1.0.0 | 1.0.1 |", "### a 1.1.0", "a one", "a and docs", "### b 1.0.1", "b one"} {
+		if !strings.Contains(subProjects, want) {
+			t.Errorf("subprojects of the central entry don't list %q:\n%s", want, subProjects)
+		}
+	}
+	// Commits touching a subproject, even along with central files, are
+	// listed under the subproject only
+	for subject, want := range map[string]bool{"init": true, "central only": true, "a one": false, "a and docs": false, "b one": false} {
+		if listed := strings.Contains(central, subject); listed != want {
+			t.Errorf("central changes list %q = %t, want %t:\n%s", subject, listed, want, central)
+		}
+	}
+
+	// b is released again without new commits, so its version doesn't change
+	r.commit("fix: a two", map[string]string{"svc/a/main.go": "3"})
+	cfg.Version, cfg.SubProjects[0].Version = "1.2.0", "1.1.1"
+	if _, err := GenerateChangelogs(cfg, "reports", map[string]string{"a": "1.1.0", "b": "1.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	subProjects, central = centralEntry(t)
+	if !strings.HasPrefix(subProjects, "## [1.2.0]") || !strings.Contains(subProjects, "| a | 1.1.0 | 1.1.1 |") || !strings.Contains(subProjects, "a two") {
+		t.Errorf("central entry doesn't list a 1.1.1:\n%s", subProjects)
+	}
+	if strings.Contains(subProjects, "| b |") || strings.Contains(subProjects, "### b") {
+		t.Errorf("central entry lists b, whose version didn't change:\n%s", subProjects)
+	}
+	if central != "" {
+		t.Errorf("central entry has central changes, all of which are a's:\n%s", central)
+	}
+}
@@ -0,0 +1,302 @@
+// pkg/changelog/commits.go
+package changelog
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"buildy/pkg/config"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Commit is a commit as it appears in a changelog, parsed as a conventional
+// commit: "type(scope)!: subject", optionally followed by a body and a
+// "BREAKING CHANGE: note" footer. Type and Scope are empty for other commits.
+type Commit struct {
+	Hash     string `json:"hash" yaml:"hash"`
+	Type     string `json:"type,omitempty" yaml:"type,omitempty"`
+	Scope    string `json:"scope,omitempty" yaml:"scope,omitempty"`
+	Subject  string `json:"subject" yaml:"subject"`
+	Body     string `json:"body,omitempty" yaml:"body,omitempty"`
+	Breaking bool   `json:"breaking,omitempty" yaml:"breaking,omitempty"`
+	// BreakingNote is the text of a BREAKING CHANGE footer, if any
+	BreakingNote string    `json:"breakingNote,omitempty" yaml:"breakingNote,omitempty"`
+	Author       string    `json:"author" yaml:"author"`
+	Email        string    `json:"email" yaml:"email"`
+	Date         time.Time `json:"date" yaml:"date"`
+	Merge        bool      `json:"merge,omitempty" yaml:"merge,omitempty"`
+	// URL links to the commit when the changelog config has a commitURL
+	URL string `json:"url,omitempty" yaml:"url,omitempty"`
+	// CoAuthors are the people in Co-authored-by trailers, without a
+	// commit count
+	CoAuthors []Author `json:"coAuthors,omitempty" yaml:"coAuthors,omitempty"`
+	// Issues are the issues the message refers to, in order of appearance
+	Issues []Issue `json:"issues,omitempty" yaml:"issues,omitempty"`
+}
+
+// Issue is an issue reference such as "#123" or "JIRA-456"
+type Issue struct {
+	ID string `json:"id" yaml:"id"`
+	// URL links to the issue when the changelog config has an issueURL
+	// or trackerURL for it
+	URL string `json:"url,omitempty" yaml:"url,omitempty"`
+}
+
+func (c Commit) ShortHash() string {
+	return shortHash(c.Hash)
+}
+
+// Section is a group of commits under a heading such as "Added" or "Fixed"
+type Section struct {
+	Title   string   `json:"title" yaml:"title"`
+	Commits []Commit `json:"commits" yaml:"commits"`
+}
+
+const (
+	breakingSection = "Breaking Changes"
+	// Commits that aren't conventional, or of an unknown type, are changes
+	otherSection = "Changed"
+)
+
+// Keep a Changelog sections by commit type, and the order they appear in
+var defaultSections = map[string]string{
+	"feat":      "Added",
+	"fix":       "Fixed",
+	"perf":      "Changed",
+	"refactor":  "Changed",
+	"docs":      "Changed",
+	"revert":    "Changed",
+	"deprecate": "Deprecated",
+	"remove":    "Removed",
+	"security":  "Security",
+}
+
+var sectionOrder = []string{breakingSection, "Added", "Changed", "Deprecated", "Removed", "Fixed", "Security"}
+
+var defaultExclude = []string{"chore", "ci", "build", "style", "test"}
+
+var (
+	conventionalSubject = regexp.MustCompile(`^(\w+)(?:\(([^)]*)\))?(!)?: *(.+)$`)
+	breakingFooter      = regexp.MustCompile(`(?m)^BREAKING[ -]CHANGE: *(.+(?:\n[^\n]+)*)`)
+	mergeSubject        = regexp.MustCompile(`^Merge (branch|pull request|remote-tracking branch|tag) `)
+	coAuthorTrailer     = regexp.MustCompile(`(?mi)^Co-authored-by: *(.+?) *<([^>]*)> *$`)
+	// "#123" but not "a#1" or the fragment of a URL
+	issueNumber = regexp.MustCompile(`(?:^|[^\w/&#])(#\d+)\b`)
+	issueKey    = regexp.MustCompile(`\b([A-Z][A-Z0-9]+-\d+)\b`)
+)
+
+func parseCommit(commit *object.Commit) Commit {
+	message := strings.TrimSpace(commit.Message)
+	subject, body := message, ""
+	if i := strings.Index(message, "\n"); i >= 0 {
+		subject, body = strings.TrimSpace(message[:i]), strings.TrimSpace(message[i+1:])
+	}
+
+	c := Commit{
+		Hash:    commit.Hash.String(),
+		Subject: subject,
+		Body:    body,
+		Author:  commit.Author.Name,
+		Email:   commit.Author.Email,
+		Date:    commit.Author.When,
+		Merge:   commit.NumParents() > 1 || mergeSubject.MatchString(subject),
+	}
+
+	if m := conventionalSubject.FindStringSubmatch(subject); m != nil {
+		c.Type = strings.ToLower(m[1])
+		c.Scope = strings.TrimSpace(m[2])
+		c.Breaking = m[3] == "!"
+		c.Subject = strings.TrimSpace(m[4])
+	}
+	if m := breakingFooter.FindStringSubmatch(body); m != nil {
+		c.Breaking = true
+		c.BreakingNote = strings.Join(strings.Fields(m[1]), " ")
+	}
+	for _, m := range coAuthorTrailer.FindAllStringSubmatch(body, -1) {
+		c.CoAuthors = append(c.CoAuthors, Author{Name: m[1], Email: m[2]})
+	}
+	c.Issues = parseIssues(message)
+
+	return c
+}
+
+// parseIssues finds issue numbers and keys in a commit message, each once
+func parseIssues(message string) []Issue {
+	type match struct {
+		at int
+		id string
+	}
+	var matches []match
+	for _, m := range issueNumber.FindAllStringSubmatchIndex(message, -1) {
+		matches = append(matches, match{m[2], message[m[2]:m[3]]})
+	}
+	for _, m := range issueKey.FindAllStringSubmatchIndex(message, -1) {
+		matches = append(matches, match{m[2], message[m[2]:m[3]]})
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].at < matches[j].at })
+
+	var issues []Issue
+	seen := make(map[string]bool)
+	for _, m := range matches {
+		if !seen[m.id] {
+			seen[m.id] = true
+			issues = append(issues, Issue{ID: m.id})
+		}
+	}
+	return issues
+}
+
+func parseCommits(commits []*object.Commit) []Commit {
+	parsed := make([]Commit, len(commits))
+	for i, commit := range commits {
+		parsed[i] = parseCommit(commit)
+	}
+	return parsed
+}
+
+// rules decide which commits make it into a changelog and under which section
+type rules struct {
+	sections      map[string]string
+	exclude       map[string]bool
+	patterns      []*regexp.Regexp
+	includeMerges bool
+	commitURLs    string
+	compareURLs   string
+	issueURLs     string
+	trackerURLs   string
+	// issueKeys are the projects whose issue keys are kept, none if empty
+	issueKeys map[string]bool
+}
+
+func newRules(cfg config.ChangelogConfig) (*rules, error) {
+	r := &rules{
+		sections:      make(map[string]string),
+		exclude:       make(map[string]bool),
+		includeMerges: cfg.IncludeMerges,
+		commitURLs:    cfg.CommitURL,
+		compareURLs:   cfg.CompareURL,
+		issueURLs:     cfg.IssueURL,
+		trackerURLs:   cfg.TrackerURL,
+		issueKeys:     make(map[string]bool),
+	}
+	for _, key := range cfg.IssueKeys {
+		r.issueKeys[strings.ToUpper(key)] = true
+	}
+	for commitType, title := range defaultSections {
+		r.sections[commitType] = title
+	}
+	for commitType, title := range cfg.Sections {
+		r.sections[strings.ToLower(commitType)] = title
+	}
+
+	for _, commitType := range append(defaultExclude, cfg.Exclude...) {
+		r.exclude[strings.ToLower(commitType)] = true
+	}
+	for _, commitType := range cfg.Include {
+		delete(r.exclude, strings.ToLower(commitType))
+	}
+
+	for _, pattern := range cfg.ExcludePatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid changelog exclude pattern %q: %v", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+
+	return r, nil
+}
+
+func (r *rules) keep(c Commit) bool {
+	if c.Merge && !r.includeMerges {
+		return false
+	}
+	// Breaking changes are always worth mentioning, whatever their type
+	if r.exclude[c.Type] && !c.Breaking {
+		return false
+	}
+	for _, re := range r.patterns {
+		if re.MatchString(c.Subject) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *rules) commitURL(hash string) string {
+	if r.commitURLs == "" {
+		return ""
+	}
+	return strings.ReplaceAll(r.commitURLs, "{hash}", hash)
+}
+
+func (r *rules) compareURL(from, to string) string {
+	if r.compareURLs == "" || from == "" || to == "" {
+		return ""
+	}
+	return strings.NewReplacer("{from}", from, "{to}", to).Replace(r.compareURLs)
+}
+
+// issues drops issue keys of other projects than the configured ones, all
+// of them without any, and links the rest
+func (r *rules) issues(issues []Issue) []Issue {
+	var kept []Issue
+	for _, issue := range issues {
+		if strings.HasPrefix(issue.ID, "#") {
+			if r.issueURLs != "" {
+				issue.URL = strings.ReplaceAll(r.issueURLs, "{id}", strings.TrimPrefix(issue.ID, "#"))
+			}
+		} else {
+			project := issue.ID[:strings.LastIndex(issue.ID, "-")]
+			if !r.issueKeys[project] {
+				continue
+			}
+			if r.trackerURLs != "" {
+				issue.URL = strings.ReplaceAll(r.trackerURLs, "{id}", issue.ID)
+			}
+		}
+		kept = append(kept, issue)
+	}
+	return kept
+}
+
+// group filters commits and sorts them into sections, in the Keep a
+// Changelog order followed by custom sections by title. Commits keep their
+// order within a section.
+func (r *rules) group(commits []Commit) []Section {
+	bySection := make(map[string][]Commit)
+	for _, c := range commits {
+		if !r.keep(c) {
+			continue
+		}
+		title := otherSection
+		if c.Breaking {
+			title = breakingSection
+		} else if t, ok := r.sections[c.Type]; ok {
+			title = t
+		}
+		bySection[title] = append(bySection[title], c)
+	}
+
+	var sections []Section
+	for _, title := range sectionOrder {
+		if commits, ok := bySection[title]; ok {
+			sections = append(sections, Section{Title: title, Commits: commits})
+			delete(bySection, title)
+		}
+	}
+	var custom []string
+	for title := range bySection {
+		custom = append(custom, title)
+	}
+	sort.Strings(custom)
+	for _, title := range custom {
+		sections = append(sections, Section{Title: title, Commits: bySection[title]})
+	}
+
+	return sections
+}
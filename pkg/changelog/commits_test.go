@@ -0,0 +1,194 @@
+// pkg/changelog/commits_test.go
+package changelog
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"buildy/pkg/config"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func testCommit(message string, parents ...string) *object.Commit {
+	commit := &object.Commit{
+		Hash:    plumbing.ComputeHash(plumbing.CommitObject, []byte(message)),
+		Message: message,
+		Author:  object.Signature{Name: "Ada", Email: "ada@example.com", When: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+	}
+	for _, parent := range parents {
+		commit.ParentHashes = append(commit.ParentHashes, plumbing.NewHash(parent))
+	}
+	return commit
+}
+
+func TestParseCommit(t *testing.T) {
+	tests := []struct {
+		message string
+		want    Commit
+	}{
+		{"feat(api): add users endpoint", Commit{Type: "feat", Scope: "api", Subject: "add users endpoint"}},
+		{"fix: handle nil config\n\nDetails here.", Commit{Type: "fix", Subject: "handle nil config", Body: "Details here."}},
+		{"Feat!: drop v1", Commit{Type: "feat", Subject: "drop v1", Breaking: true}},
+		{"refactor(core)!:   rename options", Commit{Type: "refactor", Scope: "core", Subject: "rename options", Breaking: true}},
+		{"perf: cache lookups\n\nBREAKING CHANGE: the cache\nmoved to ~/.cache", Commit{Type: "perf", Subject: "cache lookups", Body: "BREAKING CHANGE: the cache\nmoved to ~/.cache", Breaking: true, BreakingNote: "the cache moved to ~/.cache"}},
+		{"Update README", Commit{Subject: "Update README"}},
+		{"not conventional: (has colon", Commit{Subject: "not conventional: (has colon"}},
+		{"Merge branch 'main' into feature", Commit{Subject: "Merge branch 'main' into feature", Merge: true}},
+	}
+	for _, test := range tests {
+		got := parseCommit(testCommit(test.message))
+		got.Hash, got.Author, got.Email, got.Date = "", "", "", time.Time{}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseCommit(%q) =\n%+v, want\n%+v", test.message, got, test.want)
+		}
+	}
+
+	if c := parseCommit(testCommit("feat: merged", "1111111111111111111111111111111111111111", "2222222222222222222222222222222222222222")); !c.Merge {
+		t.Error("a commit with two parents is not a merge")
+	}
+}
+
+func subjects(section Section) []string {
+	var subjects []string
+	for _, c := range section.Commits {
+		subjects = append(subjects, c.Subject)
+	}
+	return subjects
+}
+
+func TestGroup(t *testing.T) {
+	var commits []Commit
+	for _, message := range []string{
+		"fix: second fix",
+		"chore: bump deps",
+		"docs: explain config",
+		"feat(ui): dark mode",
+		"security: patch CVE",
+		"fix: first fix",
+		"chore!: drop go 1.18",
+		"Tweak wording",
+		"ops: new runbook",
+		"Merge branch 'main'",
+		"feat: wip do not release",
+	} {
+		commits = append(commits, parseCommit(testCommit(message)))
+	}
+
+	r, err := newRules(config.ChangelogConfig{
+		Sections:        map[string]string{"ops": "Operations"},
+		ExcludePatterns: []string{"(?i)wip"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sections := r.group(commits)
+
+	want := []struct {
+		title    string
+		subjects []string
+	}{
+		{"Breaking Changes", []string{"drop go 1.18"}},
+		{"Added", []string{"dark mode"}},
+		{"Changed", []string{"explain config", "Tweak wording"}},
+		{"Fixed", []string{"second fix", "first fix"}},
+		{"Security", []string{"patch CVE"}},
+		{"Operations", []string{"new runbook"}},
+	}
+	if len(sections) != len(want) {
+		t.Fatalf("got %d sections %+v, want %d", len(sections), sections, len(want))
+	}
+	for i, section := range sections {
+		if section.Title != want[i].title || !reflect.DeepEqual(subjects(section), want[i].subjects) {
+			t.Errorf("section %d = %s %q, want %s %q", i, section.Title, subjects(section), want[i].title, want[i].subjects)
+		}
+	}
+}
+
+func TestGroupIncludeAndMerges(t *testing.T) {
+	commits := []Commit{
+		parseCommit(testCommit("chore: bump deps")),
+		parseCommit(testCommit("test: more cases")),
+		parseCommit(testCommit("Merge pull request #1 from fork")),
+	}
+
+	r, err := newRules(config.ChangelogConfig{Include: []string{"chore"}, Exclude: []string{"feat"}, IncludeMerges: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sections := r.group(commits)
+	if len(sections) != 1 || !reflect.DeepEqual(subjects(sections[0]), []string{"bump deps", "Merge pull request #1 from fork"}) {
+		t.Errorf("sections = %+v", sections)
+	}
+	if r.keep(parseCommit(testCommit("feat: excluded"))) {
+		t.Error("an excluded type was kept")
+	}
+	if !r.keep(parseCommit(testCommit("feat!: breaking"))) {
+		t.Error("a breaking change of an excluded type was dropped")
+	}
+
+	if _, err := newRules(config.ChangelogConfig{ExcludePatterns: []string{"("}}); err == nil {
+		t.Error("expected an error for an invalid exclude pattern")
+	}
+}
+
+func TestParseIssues(t *testing.T) {
+	message := "fix: close #12 and JIRA-7 (see ops-1, OPS-3, a#5, #12)\n\nEncode as UTF-8, http://x/y#9 and JIRA-7 again"
+	var got []string
+	for _, issue := range parseIssues(message) {
+		got = append(got, issue.ID)
+	}
+	want := []string{"#12", "JIRA-7", "OPS-3", "UTF-8"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseIssues = %q, want %q", got, want)
+	}
+}
+
+func TestRulesIssues(t *testing.T) {
+	issues := []Issue{{ID: "#12"}, {ID: "JIRA-7"}, {ID: "UTF-8"}, {ID: "SHA-256"}}
+
+	tests := []struct {
+		name string
+		cfg  config.ChangelogConfig
+		want []Issue
+	}{
+		{"without issue keys", config.ChangelogConfig{IssueURL: "https://example.com/issues/{id}"},
+			[]Issue{{ID: "#12", URL: "https://example.com/issues/12"}}},
+		{"with issue keys", config.ChangelogConfig{IssueKeys: []string{"jira"}, TrackerURL: "https://jira.example.com/browse/{id}"},
+			[]Issue{{ID: "#12"}, {ID: "JIRA-7", URL: "https://jira.example.com/browse/JIRA-7"}}},
+	}
+	for _, test := range tests {
+		r, err := newRules(test.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.issues(issues); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: issues = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCoAuthors(t *testing.T) {
+	c := parseCommit(testCommit("feat: pair on it\n\nDetails.\n\nCo-authored-by: Grace Hopper <grace@example.com>\nco-authored-by:Linus <LINUS@example.com>  \nCo-authored-by: no email"))
+	want := []Author{{Name: "Grace Hopper", Email: "grace@example.com"}, {Name: "Linus", Email: "LINUS@example.com"}}
+	if !reflect.DeepEqual(c.CoAuthors, want) {
+		t.Fatalf("CoAuthors = %+v, want %+v", c.CoAuthors, want)
+	}
+
+	r, err := newRules(config.ChangelogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits := parseCommits([]*object.Commit{
+		testCommit("fix: solo"),
+		testCommit("feat: pair\n\nCo-authored-by: Linus <linus@example.com>"),
+		testCommit("feat: self\n\nCo-authored-by: Ada Again <ADA@example.com>"),
+	})
+	release := newRelease("api", "1.0.0", time.Now(), "", "", commits, r)
+	wantAuthors := []Author{{Name: "Ada", Email: "ada@example.com", Commits: 3}, {Name: "Linus", Email: "linus@example.com", Commits: 1}}
+	if !reflect.DeepEqual(release.Authors, wantAuthors) {
+		t.Errorf("Authors = %+v, want %+v", release.Authors, wantAuthors)
+	}
+}
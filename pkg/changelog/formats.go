@@ -0,0 +1,231 @@
+// pkg/changelog/formats.go
+package changelog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Changelog formats
+const (
+	FormatMarkdown = "markdown"
+	FormatAsciiDoc = "asciidoc"
+	FormatJSON     = "json"
+	FormatYAML     = "yaml"
+)
+
+// Changelog files by format, written to each subproject and, for the
+// centralized changelog, to the output directory
+var files = map[string]string{
+	FormatMarkdown: "CHANGELOG.md",
+	FormatAsciiDoc: "CHANGELOG.adoc",
+	FormatJSON:     "changelog.json",
+	FormatYAML:     "changelog.yaml",
+}
+
+// Built-in templates of the AsciiDoc entries; markdown entries use the
+// configurable templates
+const (
+	subProjectAsciiDocTemplate = "subproject.adoc.tmpl"
+	centralAsciiDocTemplate    = "central.adoc.tmpl"
+)
+
+// Formats lists the supported changelog formats
+func Formats() []string {
+	formats := make([]string, 0, len(files))
+	for format := range files {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Files lists the names of the changelog files of every format, which
+// buildy writes into subprojects itself
+func Files() []string {
+	names := make([]string, 0, len(files))
+	for _, name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func ValidateFormats(formats []string) error {
+	for _, format := range formats {
+		if _, ok := files[format]; !ok {
+			return fmt.Errorf("unknown changelog format %q (expected one of %s)", format, strings.Join(Formats(), ", "))
+		}
+	}
+	return nil
+}
+
+// writeEntry adds release, a Release or a CentralRelease, to the changelog
+// in dir in each configured format. markdown renders the markdown entry.
+func (g *generator) writeEntry(dir string, release interface{}, markdown *template.Template) error {
+	for _, format := range g.formats {
+		file := filepath.Join(dir, files[format])
+		content, _ := ioutil.ReadFile(file)
+
+		var updated []byte
+		var err error
+		switch format {
+		case FormatMarkdown:
+			updated, err = prependEntry(content, release, markdown)
+		case FormatAsciiDoc:
+			builtin := subProjectAsciiDocTemplate
+			if _, ok := release.(CentralRelease); ok {
+				builtin = centralAsciiDocTemplate
+			}
+			var tmpl *template.Template
+			tmpl, err = g.templates.load("", builtin)
+			if err == nil {
+				updated, err = prependEntry(content, release, tmpl)
+			}
+		case FormatJSON:
+			updated, err = prependJSON(content, release)
+		case FormatYAML:
+			updated, err = prependYAML(content, release)
+		}
+		if err != nil {
+			return fmt.Errorf("error updating %s: %v", file, err)
+		}
+
+		err = ioutil.WriteFile(file, updated, 0644)
+		if err != nil {
+			return fmt.Errorf("error writing changelog file %s: %v", file, err)
+		}
+	}
+	return nil
+}
+
+// hasVersion reports whether a changelog in format has an entry for
+// version: a "## [version]" heading in markdown, a "== version (date)"
+// heading in AsciiDoc, or a release with the version in JSON and YAML
+func hasVersion(format string, content []byte, version string) bool {
+	var versions []string
+	switch format {
+	case FormatMarkdown:
+		return hasHeading(content, "## ["+version+"]")
+	case FormatAsciiDoc:
+		return hasHeading(content, "== "+version+" (")
+	case FormatJSON:
+		var doc struct {
+			Releases []struct {
+				Version string `json:"version"`
+			} `json:"releases"`
+		}
+		if json.Unmarshal(content, &doc) != nil {
+			return false
+		}
+		for _, release := range doc.Releases {
+			versions = append(versions, release.Version)
+		}
+	case FormatYAML:
+		var doc struct {
+			Releases []struct {
+				Version string `yaml:"version"`
+			} `yaml:"releases"`
+		}
+		if yaml.Unmarshal(content, &doc) != nil {
+			return false
+		}
+		for _, release := range doc.Releases {
+			versions = append(versions, release.Version)
+		}
+	}
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+func hasHeading(content []byte, heading string) bool {
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), heading) {
+			return true
+		}
+	}
+	return false
+}
+
+// prependEntry renders the entry of a text changelog and puts it in front
+func prependEntry(content []byte, release interface{}, tmpl *template.Template) ([]byte, error) {
+	entry, err := render(tmpl, release)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("%s\n%s", entry, string(content))), nil
+}
+
+// JSON and YAML changelogs are a document of every release, newest first.
+// Earlier releases are kept as they were written, whatever fields they have.
+type jsonChangelog struct {
+	Releases []json.RawMessage `json:"releases"`
+}
+
+type yamlChangelog struct {
+	Releases []yaml.MapSlice `yaml:"releases"`
+}
+
+func prependJSON(content []byte, release interface{}) ([]byte, error) {
+	var doc jsonChangelog
+	if len(bytes.TrimSpace(content)) > 0 {
+		if err := json.Unmarshal(content, &doc); err != nil {
+			return nil, fmt.Errorf("error parsing changelog: %v", err)
+		}
+	}
+
+	data, err := marshalJSON(release)
+	if err != nil {
+		return nil, err
+	}
+	doc.Releases = append([]json.RawMessage{data}, doc.Releases...)
+	return marshalJSON(doc)
+}
+
+func prependYAML(content []byte, release interface{}) ([]byte, error) {
+	var doc yamlChangelog
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing changelog: %v", err)
+	}
+
+	// Go through yaml.MapSlice to keep the fields in order
+	data, err := yaml.Marshal(release)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding changelog: %v", err)
+	}
+	var entry yaml.MapSlice
+	if err := yaml.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("error encoding changelog: %v", err)
+	}
+	doc.Releases = append([]yaml.MapSlice{entry}, doc.Releases...)
+
+	data, err = yaml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding changelog: %v", err)
+	}
+	return data, nil
+}
+
+// marshalJSON indents v and leaves <, > and & alone, as in email addresses
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, fmt.Errorf("error encoding changelog: %v", err)
+	}
+	return buf.Bytes(), nil
+}
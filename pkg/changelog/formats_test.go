@@ -0,0 +1,132 @@
+// pkg/changelog/formats_test.go
+package changelog
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"buildy/pkg/config"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"gopkg.in/yaml.v2"
+)
+
+func testRelease(version string) Release {
+	r, _ := newRules(config.ChangelogConfig{})
+	commits := parseCommits([]*object.Commit{testCommit("feat: add <users> & roles"), testCommit("fix: handle nil config")})
+	return newRelease("api", version, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), "", "abc", commits, r)
+}
+
+func TestPrependJSON(t *testing.T) {
+	data, err := prependJSON(nil, testRelease("1.0.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fields of earlier releases are kept even if Release no longer has them
+	data = []byte(strings.Replace(string(data), `"project": "api"`, `"project": "api", "legacy": true`, 1))
+	data, err = prependJSON(data, testRelease("1.1.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Releases []map[string]interface{} `json:"releases"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("invalid JSON changelog: %v\n%s", err, data)
+	}
+	if len(doc.Releases) != 2 || doc.Releases[0]["version"] != "1.1.0" || doc.Releases[1]["version"] != "1.0.0" || doc.Releases[1]["legacy"] != true {
+		t.Errorf("releases = %v", doc.Releases)
+	}
+	if !strings.Contains(string(data), "add <users> & roles") {
+		t.Errorf("HTML characters are escaped:\n%s", data)
+	}
+
+	if _, err := prependJSON([]byte("not json"), testRelease("1.2.0")); err == nil {
+		t.Error("expected an error for an invalid changelog")
+	}
+}
+
+func TestPrependYAML(t *testing.T) {
+	data, err := prependYAML(nil, testRelease("1.0.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = prependYAML(data, testRelease("1.1.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc yamlChangelog
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("invalid YAML changelog: %v\n%s", err, data)
+	}
+	var versions []interface{}
+	for _, release := range doc.Releases {
+		// Fields keep the order of Release
+		if release[0].Key != "project" || release[1].Key != "version" {
+			t.Errorf("fields out of order: %v", release)
+		}
+		versions = append(versions, release[1].Value)
+	}
+	if want := []interface{}{"1.1.0", "1.0.0"}; !reflect.DeepEqual(versions, want) {
+		t.Errorf("versions = %v, want %v", versions, want)
+	}
+
+	if _, err := prependYAML([]byte("releases: {"), testRelease("1.2.0")); err == nil {
+		t.Error("expected an error for an invalid changelog")
+	}
+}
+
+func TestWriteEntry(t *testing.T) {
+	dir := t.TempDir()
+	g, err := newGenerator(&config.Config{Changelog: config.ChangelogConfig{Formats: Formats()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := g.templates.load("", subProjectTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		if err := g.writeEntry(dir, testRelease(version), tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, format := range Formats() {
+		content, err := ioutil.ReadFile(filepath.Join(dir, files[format]))
+		if err != nil {
+			t.Errorf("%s: %v", format, err)
+			continue
+		}
+		for _, version := range []string{"1.0.0", "1.1.0"} {
+			if !hasVersion(format, content, version) {
+				t.Errorf("%s changelog has no entry for %s:\n%s", format, version, content)
+			}
+		}
+		if hasVersion(format, content, "1.0") {
+			t.Errorf("%s changelog has an entry for 1.0", format)
+		}
+	}
+
+	markdown, _ := ioutil.ReadFile(filepath.Join(dir, files[FormatMarkdown]))
+	if strings.Index(string(markdown), "## [1.1.0]") > strings.Index(string(markdown), "## [1.0.0]") {
+		t.Errorf("newest entry is not first:\n%s", markdown)
+	}
+}
+
+func TestValidateFormats(t *testing.T) {
+	if err := ValidateFormats(Formats()); err != nil {
+		t.Error(err)
+	}
+	if err := ValidateFormats([]string{FormatJSON, "html"}); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,103 @@
+// pkg/changelog/helpers_test.go
+package changelog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// testRepo builds a Git repository commit by commit
+type testRepo struct {
+	t    *testing.T
+	dir  string
+	repo *git.Repository
+	// when is the author date of the next commit, one minute after the last
+	when time.Time
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	t.Helper()
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testRepo{t: t, dir: dir, repo: repo, when: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+}
+
+// commit writes files, each with content, and commits them on top of
+// parents, or of HEAD when there are none
+func (r *testRepo) commit(message string, files map[string]string, parents ...plumbing.Hash) plumbing.Hash {
+	r.t.Helper()
+	r.when = r.when.Add(time.Minute)
+	return r.commitAt(r.when, message, files, parents...)
+}
+
+func (r *testRepo) commitAt(when time.Time, message string, files map[string]string, parents ...plumbing.Hash) plumbing.Hash {
+	r.t.Helper()
+	worktree, err := r.repo.Worktree()
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	for name, content := range files {
+		file := filepath.Join(r.dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+			r.t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			r.t.Fatal(err)
+		}
+		if _, err := worktree.Add(name); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+
+	hash, err := worktree.Commit(message, &git.CommitOptions{
+		Author:            &object.Signature{Name: "Ada", Email: "ada@example.com", When: when},
+		Parents:           parents,
+		AllowEmptyCommits: true,
+	})
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return hash
+}
+
+// chdir makes dir the current directory until the test ends
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func (r *testRepo) commitObject(hash plumbing.Hash) *object.Commit {
+	r.t.Helper()
+	commit, err := r.repo.CommitObject(hash)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return commit
+}
+
+// messages returns the first line of each commit's message
+func messages(commits []*object.Commit) []string {
+	var result []string
+	for _, commit := range commits {
+		result = append(result, strings.SplitN(commit.Message, "\n", 2)[0])
+	}
+	return result
+}
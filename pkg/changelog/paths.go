@@ -0,0 +1,173 @@
+// pkg/changelog/paths.go
+package changelog
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"buildy/pkg/config"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// pathFilter selects the commits that touch files under any of a set of
+// directories, given relative to the worktree root, or anywhere without
+// directories. Changes to ignored files, or files under ignored directories,
+// alone don't select a commit. An empty filter selects every commit.
+type pathFilter struct {
+	dirs    []string
+	ignored []string
+}
+
+func newPathFilter(paths ...string) pathFilter {
+	var f pathFilter
+	for _, p := range paths {
+		p = path.Clean(filepath.ToSlash(p))
+		if p == "." || p == "/" {
+			// The whole repository
+			return pathFilter{}
+		}
+		f.dirs = append(f.dirs, strings.TrimPrefix(p, "/"))
+	}
+	return f
+}
+
+// ignoreGenerated returns f ignoring the files buildy writes itself in
+// repo: the output directory, with the centralized changelog and its state,
+// the changelogs of every subproject and the configuration file. Commits
+// that only release a new version, committing those files, then aren't new
+// changes.
+func (f pathFilter) ignoreGenerated(repo *git.Repository, cfg *config.Config, outputDir string) (pathFilter, error) {
+	root, err := worktreeRoot(repo)
+	if err != nil {
+		return pathFilter{}, err
+	}
+
+	generated := []string{outputDir}
+	if cfg.File != "" {
+		generated = append(generated, cfg.File)
+	}
+	for _, subProject := range cfg.SubProjects {
+		for _, name := range files {
+			generated = append(generated, filepath.Join(subProject.Path, name))
+		}
+	}
+
+	ignored := append([]string(nil), f.ignored...)
+	for _, p := range generated {
+		rel, err := relativeTo(root, p)
+		if err != nil || rel == "." {
+			// Not part of this repository, or all of it
+			continue
+		}
+		ignored = append(ignored, filepath.ToSlash(rel))
+	}
+	return pathFilter{dirs: f.dirs, ignored: ignored}, nil
+}
+
+// worktreeRoot returns the absolute directory of the worktree of repo
+func worktreeRoot(repo *git.Repository) (string, error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return "", fmt.Errorf("error opening worktree: %v", err)
+	}
+	return realPath(worktree.Filesystem.Root())
+}
+
+// relativeTo makes p, absolute or relative to the current directory,
+// relative to root
+func relativeTo(root, p string) (string, error) {
+	abs, err := realPath(p)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is outside the repository at %s", p, root)
+	}
+	return rel, nil
+}
+
+// realPath returns the absolute path of p with symlinks resolved, so that
+// it compares with the worktree root however either was reached
+func realPath(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", fmt.Errorf("error resolving path %s: %v", p, err)
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved, nil
+	}
+	// A path that doesn't exist (anymore) can still match old commits
+	return abs, nil
+}
+
+func (f pathFilter) match(file string) bool {
+	if file == "" || under(file, f.ignored) {
+		return false
+	}
+	return len(f.dirs) == 0 || under(file, f.dirs)
+}
+
+// under reports whether file is one of paths or under one of them
+func under(file string, paths []string) bool {
+	for _, p := range paths {
+		if file == p || strings.HasPrefix(file, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// touches reports whether a commit changed a matching file compared to its
+// first parent, or added one if it is a root commit
+func (f pathFilter) touches(commit *object.Commit) (bool, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return false, err
+	}
+
+	var parentTree *object.Tree
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return false, err
+		}
+		parentTree, err = parent.Tree()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return false, err
+	}
+	for _, change := range changes {
+		if f.match(change.From.Name) || f.match(change.To.Name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f pathFilter) filter(commits []*object.Commit) ([]*object.Commit, error) {
+	if len(f.dirs) == 0 && len(f.ignored) == 0 {
+		return commits, nil
+	}
+
+	var matching []*object.Commit
+	for _, commit := range commits {
+		ok, err := f.touches(commit)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matching = append(matching, commit)
+		}
+	}
+	return matching, nil
+}
@@ -0,0 +1,82 @@
+// pkg/changelog/paths_test.go
+package changelog
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"buildy/pkg/config"
+)
+
+func TestSubProjectSourcePaths(t *testing.T) {
+	r := newTestRepo(t)
+	r.commit("add a", map[string]string{"svc/a/main.go": "a"})
+	r.commit("add b", map[string]string{"svc/b/main.go": "b"})
+	r.commit("add proto", map[string]string{"proto/api.proto": "api"})
+	r.commit("add readme", map[string]string{"README.md": "readme"})
+	r.commit("change a", map[string]string{"svc/a/main.go": "a2"})
+	r.commit("add ab", map[string]string{"svc/ab/main.go": "ab"})
+
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(r.dir, link); err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(filepath.Join(r.dir, "svc")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		subProject config.SubProject
+		want       []string
+	}{
+		{"relative to the current directory", config.SubProject{Path: "./a"}, []string{"change a", "add a"}},
+		{"absolute", config.SubProject{Path: filepath.Join(r.dir, "svc", "a")}, []string{"change a", "add a"}},
+		{"through a symlink", config.SubProject{Path: filepath.Join(link, "svc", "a")}, []string{"change a", "add a"}},
+		{"with changelog paths", config.SubProject{Path: "b", ChangelogPaths: []string{"proto", filepath.Join(r.dir, "README.md")}}, []string{"add readme", "add proto", "add b"}},
+		{"the whole repository", config.SubProject{Path: ".."}, []string{"add ab", "change a", "add readme", "add proto", "add b", "add a"}},
+	}
+	for _, test := range tests {
+		repo, paths, err := subProjectSource(r.repo, test.subProject)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		commits, _, err := newCommits(repo, paths, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := messages(commits); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: commits = %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	for _, outside := range []config.SubProject{{Path: "../.."}, {Path: "a", ChangelogPaths: []string{t.TempDir()}}} {
+		if _, _, err := subProjectSource(r.repo, outside); err == nil {
+			t.Errorf("subProjectSource(%+v): expected an error for a path outside the repository", outside)
+		}
+	}
+}
+
+func TestPathFilterMatch(t *testing.T) {
+	f := newPathFilter("./svc/a/", "/proto")
+	if !reflect.DeepEqual(f.dirs, []string{"svc/a", "proto"}) {
+		t.Fatalf("newPathFilter = %q", f.dirs)
+	}
+	for file, want := range map[string]bool{"svc/a": true, "svc/a/x.go": true, "svc/ab/x.go": false, "proto/x": true, "README.md": false} {
+		if got := f.match(file); got != want {
+			t.Errorf("match(%s) = %v, want %v", file, got, want)
+		}
+	}
+	if newPathFilter(".", "svc").dirs != nil {
+		t.Error("a filter including the repository root must select every commit")
+	}
+}
@@ -0,0 +1,266 @@
+// pkg/changelog/preview.go
+package changelog
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"buildy/pkg/config"
+	"buildy/pkg/versioning"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Range selects the entry Preview renders: the entry of a released version,
+// or the commits between two revisions (tags, branches or hashes)
+type Range struct {
+	// Project is a subproject name, or empty for the central project
+	Project string
+	Version string
+	From    string
+	To      string
+}
+
+// Release notes formats
+const (
+	NotesMarkdown = "markdown"
+	NotesJSON     = "json"
+)
+
+// Preview renders a changelog entry without writing any changelog or
+// moving the checkpoints.
+//
+// With only Version set, the entry covers the commits the version was
+// released with, as recorded in the changelog state or else by its tags:
+// <subproject>-vX.Y.Z, <subproject>/vX.Y.Z (with or without the v) for
+// subprojects and vX.Y.Z or X.Y.Z for the central project, starting at the
+// previous version's tag. Otherwise From defaults to the last checkpoint
+// and To to HEAD, and Version only names the entry.
+func Preview(cfg *config.Config, outputDir string, r Range) (string, error) {
+	p, err := newPreview(cfg, outputDir, r)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := p.g.templates.load(p.templatePath, p.builtin)
+	if err != nil {
+		return "", err
+	}
+	return render(tmpl, p.release)
+}
+
+// ReleaseNotes renders the release notes of the same entry Preview selects:
+// every change with links to its commit and issues, the issues referenced
+// and the contributors, as markdown or JSON.
+func ReleaseNotes(cfg *config.Config, outputDir string, r Range, format string) (string, error) {
+	p, err := newPreview(cfg, outputDir, r)
+	if err != nil {
+		return "", err
+	}
+
+	switch format {
+	case NotesMarkdown:
+		tmpl, err := p.g.templates.load(cfg.Changelog.NotesTemplate, notesTemplate)
+		if err != nil {
+			return "", err
+		}
+		return render(tmpl, p.release)
+	case NotesJSON:
+		data, err := marshalJSON(p.release)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	return "", fmt.Errorf("unknown release notes format %q (expected %s or %s)", format, NotesMarkdown, NotesJSON)
+}
+
+// preview is an entry selected by a Range, ready to render
+type preview struct {
+	g *generator
+	// release is a Release for a subproject or a CentralRelease
+	release      interface{}
+	templatePath string
+	builtin      string
+}
+
+func newPreview(cfg *config.Config, outputDir string, r Range) (*preview, error) {
+	g, err := newGenerator(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	mainRepo, err := git.PlainOpen(".")
+	if err != nil {
+		return nil, fmt.Errorf("error opening main Git repository: %v", err)
+	}
+
+	st, err := loadState(filepath.Join(outputDir, StateFile), filepath.Join(outputDir, "CHANGELOG.md"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Central project defaults
+	repo := mainRepo
+	paths := newPathFilter()
+	tagPrefixes := []string{"v", ""}
+	templatePath, builtin := cfg.Changelog.CentralTemplate, centralTemplate
+	var cp checkpoint
+	if st.Central != nil {
+		cp = *st.Central
+	}
+
+	var subProject *config.SubProject
+	if r.Project != "" {
+		for i := range cfg.SubProjects {
+			if cfg.SubProjects[i].Name == r.Project {
+				subProject = &cfg.SubProjects[i]
+			}
+		}
+		if subProject == nil {
+			return nil, fmt.Errorf("subproject %s not found in configuration", r.Project)
+		}
+		repo, paths, err = subProjectSource(mainRepo, *subProject)
+		if err != nil {
+			return nil, err
+		}
+		tagPrefixes = []string{subProject.Name + "-v", subProject.Name + "-", subProject.Name + "/v", subProject.Name + "/"}
+		templatePath, builtin = subProject.ChangelogTemplate, subProjectTemplate
+		if templatePath == "" {
+			templatePath = cfg.Changelog.Template
+		}
+		cp = st.SubProjects[subProject.Name]
+	}
+
+	from, to, version := r.From, r.To, r.Version
+	if version != "" && from == "" && to == "" {
+		if rel, ok := cp.find(version); ok {
+			from, to = rel.From, rel.To
+		} else {
+			from, to, err = versionTags(repo, tagPrefixes, version)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		if from == "" {
+			from = cp.Commit
+		}
+		if to == "" {
+			to = "HEAD"
+		}
+		if version == "" {
+			version = "Unreleased"
+		}
+	}
+
+	toCommit, err := resolveCommit(repo, to)
+	if err != nil {
+		return nil, err
+	}
+	if from != "" {
+		fromCommit, err := resolveCommit(repo, from)
+		if err != nil {
+			return nil, err
+		}
+		from = fromCommit.Hash.String()
+	}
+	to = toCommit.Hash.String()
+
+	commits, err := commitRange(repo, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("error getting commits for %s..%s: %v", from, to, err)
+	}
+	paths, err = paths.ignoreGenerated(repo, cfg, outputDir)
+	if err != nil {
+		return nil, err
+	}
+	commits, err = paths.filter(commits)
+	if err != nil {
+		return nil, fmt.Errorf("error filtering commits: %v", err)
+	}
+
+	p := &preview{g: g, templatePath: templatePath, builtin: builtin}
+	date := toCommit.Author.When
+	if subProject != nil {
+		p.release = newRelease(subProject.Name, version, date, from, to, parseCommits(commits), g.rules)
+		return p, nil
+	}
+
+	// Past subproject versions aren't known for an arbitrary central range,
+	// so the central entry lists only its own changes
+	p.release = CentralRelease{
+		Release: newRelease(cfg.Name, version, date, from, to, parseCommits(commits), g.rules),
+		Checkpoint: Checkpoint{
+			Hash:    to,
+			Author:  toCommit.Author.String(),
+			Date:    toCommit.Author.When.String(),
+			Message: strings.SplitN(strings.TrimSpace(toCommit.Message), "\n", 2)[0],
+		},
+	}
+	return p, nil
+}
+
+// versionTags finds the tag of version and the tag of the version before it
+// among the tags named by one of prefixes. The range starts at the
+// beginning of the history if there is no earlier version.
+func versionTags(repo *git.Repository, prefixes []string, version string) (string, string, error) {
+	target, err := versioning.ParseVersion(version)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid version %s: %v", version, err)
+	}
+
+	tags, err := repo.Tags()
+	if err != nil {
+		return "", "", fmt.Errorf("error listing tags: %v", err)
+	}
+
+	var from, to string
+	var previous *versioning.Version
+	err = tags.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().Short()
+		for _, prefix := range prefixes {
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			v, err := versioning.ParseVersion(strings.TrimPrefix(name, prefix))
+			if err != nil {
+				continue
+			}
+			switch {
+			case compareVersions(v, target) == 0:
+				to = name
+			case compareVersions(v, target) < 0 && (previous == nil || compareVersions(v, previous) > 0):
+				previous, from = v, name
+			}
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("error listing tags: %v", err)
+	}
+
+	if to == "" {
+		return "", "", fmt.Errorf("no changelog state or tag found for version %s (tried tags %s)", version, strings.Join(tagNames(prefixes, version), ", "))
+	}
+	return from, to, nil
+}
+
+func tagNames(prefixes []string, version string) []string {
+	var names []string
+	for _, prefix := range prefixes {
+		names = append(names, prefix+version)
+	}
+	return names
+}
+
+func compareVersions(a, b *versioning.Version) int {
+	for _, d := range []int{a.Major - b.Major, a.Minor - b.Minor, a.Patch - b.Patch} {
+		if d != 0 {
+			return d
+		}
+	}
+	return 0
+}
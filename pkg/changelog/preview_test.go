@@ -0,0 +1,154 @@
+// pkg/changelog/preview_test.go
+package changelog
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// previewRepo has releases of a tagged as a-v1.0.0, a-v1.1.0 and a/v1.2.0,
+// and of the central project as v1.0.0 and 2.0.0
+func previewRepo(t *testing.T) (*testRepo, map[string]plumbing.Hash) {
+	r := newTestRepo(t)
+	commits := map[string]plumbing.Hash{
+		"a one":   r.commit("feat: a one", map[string]string{"svc/a/main.go": "1"}),
+		"a two":   r.commit("fix: a two", map[string]string{"svc/a/main.go": "2"}),
+		"b one":   r.commit("feat: b one", map[string]string{"svc/b/main.go": "1"}),
+		"a three": r.commit("fix: a three", map[string]string{"svc/a/main.go": "3"}),
+		"central": r.commit("docs: central", map[string]string{"README.md": "docs"}),
+	}
+	for tag, commit := range map[string]string{
+		"a-v1.0.0": "a one", "v1.0.0": "a one", "a-v1.1.0": "a two", "a/v1.2.0": "a three", "2.0.0": "central",
+		// Not a version of a
+		"ab-v1.1.5": "b one",
+	} {
+		if _, err := r.repo.CreateTag(tag, commits[commit], nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chdir(t, r.dir)
+	return r, commits
+}
+
+var subProjectPrefixes = []string{"a-v", "a-", "a/v", "a/"}
+
+func TestVersionTags(t *testing.T) {
+	r, _ := previewRepo(t)
+
+	tests := []struct {
+		prefixes       []string
+		version        string
+		wantFrom, want string
+	}{
+		{subProjectPrefixes, "1.0.0", "", "a-v1.0.0"},
+		{subProjectPrefixes, "1.1.0", "a-v1.0.0", "a-v1.1.0"},
+		{subProjectPrefixes, "1.2.0", "a-v1.1.0", "a/v1.2.0"},
+		{[]string{"v", ""}, "1.0.0", "", "v1.0.0"},
+		{[]string{"v", ""}, "2.0.0", "v1.0.0", "2.0.0"},
+	}
+	for _, test := range tests {
+		from, to, err := versionTags(r.repo, test.prefixes, test.version)
+		if err != nil {
+			t.Errorf("versionTags(%s): %v", test.version, err)
+			continue
+		}
+		if from != test.wantFrom || to != test.want {
+			t.Errorf("versionTags(%q, %s) = %q..%q, want %q..%q", test.prefixes, test.version, from, to, test.wantFrom, test.want)
+		}
+	}
+
+	_, _, err := versionTags(r.repo, subProjectPrefixes, "1.1.5")
+	if err == nil || !strings.Contains(err.Error(), "no changelog state or tag found for version 1.1.5 (tried tags a-v1.1.5, a-1.1.5, a/v1.1.5, a/1.1.5)") {
+		t.Errorf("versionTags(1.1.5) error = %v", err)
+	}
+	if _, _, err := versionTags(r.repo, subProjectPrefixes, "latest"); err == nil || !strings.Contains(err.Error(), "invalid version latest") {
+		t.Errorf("versionTags(latest) error = %v", err)
+	}
+}
+
+// previewed renders r and checks which of the commits' subjects are listed
+func previewed(t *testing.T, r Range, want ...string) string {
+	t.Helper()
+	entry, err := Preview(testConfig(), "reports", r)
+	if err != nil {
+		t.Fatalf("Preview(%+v): %v", r, err)
+	}
+	wanted := make(map[string]bool)
+	for _, subject := range want {
+		wanted[subject] = true
+	}
+	for _, subject := range []string{"a one", "a two", "b one", "a three", "central"} {
+		if listed := strings.Contains(entry, subject); listed != wanted[subject] {
+			t.Errorf("Preview(%+v) lists %q = %t, want %t:\n%s", r, subject, listed, wanted[subject], entry)
+		}
+	}
+	return entry
+}
+
+func TestPreviewVersion(t *testing.T) {
+	previewRepo(t)
+
+	entry := previewed(t, Range{Project: "a", Version: "1.1.0"}, "a two")
+	if !strings.HasPrefix(entry, "## [1.1.0] - 2024-05-01") {
+		t.Errorf("entry heading:\n%s", entry)
+	}
+	previewed(t, Range{Project: "a", Version: "1.0.0"}, "a one")
+	// Only commits under a's path count, even those between its tags
+	previewed(t, Range{Project: "a", Version: "1.2.0"}, "a three")
+	previewed(t, Range{Version: "2.0.0"}, "a two", "b one", "a three", "central")
+}
+
+func TestPreviewRange(t *testing.T) {
+	previewRepo(t)
+
+	entry := previewed(t, Range{Project: "a", From: "a-v1.0.0", To: "a/v1.2.0"}, "a two", "a three")
+	if !strings.HasPrefix(entry, "## [Unreleased]") {
+		t.Errorf("entry heading:\n%s", entry)
+	}
+	// To defaults to HEAD, and Version only names the entry
+	entry = previewed(t, Range{From: "a-v1.1.0", Version: "3.0.0"}, "b one", "a three", "central")
+	if !strings.Contains(entry, "3.0.0") {
+		t.Errorf("entry heading:\n%s", entry)
+	}
+	// Without a checkpoint the whole history is covered
+	previewed(t, Range{Project: "a"}, "a one", "a two", "a three")
+}
+
+func TestPreviewRecordedRelease(t *testing.T) {
+	_, commits := previewRepo(t)
+	st := &state{SubProjects: map[string]checkpoint{"a": {
+		Commit:   commits["a three"].String(),
+		Releases: []release{{Version: "1.1.0", From: commits["a one"].String(), To: commits["a three"].String()}},
+	}}}
+	if err := st.save(filepath.Join("reports", StateFile)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The recorded range wins over the tags
+	previewed(t, Range{Project: "a", Version: "1.1.0"}, "a two", "a three")
+	// and the checkpoint is where unreleased changes start
+	previewed(t, Range{Project: "a"})
+}
+
+func TestPreviewErrors(t *testing.T) {
+	previewRepo(t)
+
+	tests := []struct {
+		r    Range
+		want string
+	}{
+		{Range{Project: "a", Version: "9.9.9"}, "no changelog state or tag found for version 9.9.9"},
+		{Range{Version: "1.1.0"}, "no changelog state or tag found for version 1.1.0 (tried tags v1.1.0, 1.1.0)"},
+		{Range{Project: "c", Version: "1.0.0"}, "subproject c not found in configuration"},
+		{Range{Project: "a", From: "a-v0.1.0"}, "a-v0.1.0"},
+	}
+	for _, test := range tests {
+		_, err := Preview(testConfig(), "reports", test.r)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("Preview(%+v) error = %v, want %q", test.r, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// pkg/changelog/render.go
+package changelog
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Release is the data a subproject changelog entry is rendered from
+type Release struct {
+	Project string    `json:"project" yaml:"project"`
+	Version string    `json:"version" yaml:"version"`
+	Date    time.Time `json:"date" yaml:"date"`
+	// From and To are the commits the release covers, From excluded
+	From string `json:"from,omitempty" yaml:"from,omitempty"`
+	To   string `json:"to" yaml:"to"`
+	// Commits are the commits kept by the changelog rules, newest first,
+	// and Sections the same commits grouped by section
+	Commits  []Commit  `json:"commits" yaml:"commits"`
+	Sections []Section `json:"sections" yaml:"sections"`
+	// Authors are the commit authors and co-authors, in order of their
+	// latest commit
+	Authors []Author `json:"authors" yaml:"authors"`
+	// Issues are the issues referenced by the commits, each once
+	Issues []Issue `json:"issues,omitempty" yaml:"issues,omitempty"`
+	// CompareURL links to the diff between From and To when the changelog
+	// config has a compareURL
+	CompareURL string `json:"compareURL,omitempty" yaml:"compareURL,omitempty"`
+}
+
+type Author struct {
+	Name    string `json:"name" yaml:"name"`
+	Email   string `json:"email,omitempty" yaml:"email,omitempty"`
+	Commits int    `json:"commits,omitempty" yaml:"commits,omitempty"`
+}
+
+// CentralRelease is the data a centralized changelog entry is rendered
+// from. The embedded Release holds the central repository's own changes.
+type CentralRelease struct {
+	Release `yaml:",inline"`
+	// SubProjects are the subprojects updated in this release
+	SubProjects []SubProjectRelease `json:"subProjects,omitempty" yaml:"subProjects,omitempty"`
+	// Aggregate is set when the entry includes the subprojects' changes
+	Aggregate bool `json:"aggregate,omitempty" yaml:"aggregate,omitempty"`
+	// Checkpoint is the central commit this entry was generated at
+	Checkpoint Checkpoint `json:"checkpoint" yaml:"checkpoint"`
+}
+
+type SubProjectRelease struct {
+	Name            string `json:"name" yaml:"name"`
+	Version         string `json:"version" yaml:"version"`
+	PreviousVersion string `json:"previousVersion,omitempty" yaml:"previousVersion,omitempty"`
+	// Commit is the latest commit of the subproject's repository
+	Commit string `json:"commit" yaml:"commit"`
+	// Changes is the subproject's own release, in aggregated entries
+	Changes *Release `json:"changes,omitempty" yaml:"changes,omitempty"`
+}
+
+type Checkpoint struct {
+	Hash    string `json:"hash" yaml:"hash"`
+	Author  string `json:"author" yaml:"author"`
+	Date    string `json:"date" yaml:"date"`
+	Message string `json:"message" yaml:"message"`
+}
+
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+const (
+	subProjectTemplate = "subproject.md.tmpl"
+	centralTemplate    = "central.md.tmpl"
+	notesTemplate      = "release-notes.md.tmpl"
+)
+
+var templateFuncs = template.FuncMap{
+	"date":  func(t time.Time) string { return t.Format("2006-01-02") },
+	"short": shortHash,
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+}
+
+// templates loads changelog templates, from a file when a path is set or
+// the built-in ones otherwise, and keeps them for reuse
+type templates map[string]*template.Template
+
+func (t templates) load(path, builtin string) (*template.Template, error) {
+	key := path
+	if key == "" {
+		key = "builtin:" + builtin
+	}
+	if tmpl, ok := t[key]; ok {
+		return tmpl, nil
+	}
+
+	var text []byte
+	var err error
+	if path != "" {
+		text, err = ioutil.ReadFile(path)
+	} else {
+		text, err = builtinTemplates.ReadFile("templates/" + builtin)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading changelog template: %v", err)
+	}
+
+	tmpl, err := template.New(filepath.Base(key)).Funcs(templateFuncs).Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing changelog template: %v", err)
+	}
+	t[key] = tmpl
+	return tmpl, nil
+}
+
+func render(tmpl *template.Template, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, data)
+	if err != nil {
+		return "", fmt.Errorf("error rendering changelog template %s: %v", tmpl.Name(), err)
+	}
+
+	// Entries are separated by a blank line, however the template ends
+	return strings.TrimRight(buf.String(), "\n") + "\n", nil
+}
+
+// newRelease groups the commits of a release and links them using the
+// changelog rules
+func newRelease(project, version string, date time.Time, from, to string, commits []Commit, rules *rules) Release {
+	release := Release{
+		Project: project,
+		Version: version,
+		Date:    date,
+		From:    from,
+		To:      to,
+	}
+
+	authors := make(map[string]int)
+	issues := make(map[string]bool)
+	for _, c := range commits {
+		if !rules.keep(c) {
+			continue
+		}
+		c.URL = rules.commitURL(c.Hash)
+		c.Issues = rules.issues(c.Issues)
+		release.Commits = append(release.Commits, c)
+
+		// Co-authors count the commit too, but nobody counts it twice
+		counted := make(map[string]bool)
+		for _, person := range append([]Author{{Name: c.Author, Email: c.Email}}, c.CoAuthors...) {
+			key := strings.ToLower(person.Email)
+			if key == "" {
+				key = person.Name
+			}
+			if counted[key] {
+				continue
+			}
+			counted[key] = true
+			if i, ok := authors[key]; ok {
+				release.Authors[i].Commits++
+			} else {
+				authors[key] = len(release.Authors)
+				release.Authors = append(release.Authors, Author{Name: person.Name, Email: person.Email, Commits: 1})
+			}
+		}
+
+		for _, issue := range c.Issues {
+			if !issues[issue.ID] {
+				issues[issue.ID] = true
+				release.Issues = append(release.Issues, issue)
+			}
+		}
+	}
+	release.Sections = rules.group(release.Commits)
+	release.CompareURL = rules.compareURL(from, to)
+
+	return release
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
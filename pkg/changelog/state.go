@@ -0,0 +1,140 @@
+// pkg/changelog/state.go
+package changelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// StateFile records the commit each changelog was last generated at, next
+// to the centralized changelog in the output directory
+const StateFile = "changelog-state.json"
+
+type state struct {
+	Central     *checkpoint           `json:"central,omitempty"`
+	SubProjects map[string]checkpoint `json:"subProjects"`
+}
+
+type checkpoint struct {
+	Commit    string    `json:"commit"`
+	Version   string    `json:"version"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Releases lists the entries generated so far, newest first
+	Releases []release `json:"releases,omitempty"`
+}
+
+// release records the commit range a version's entry was generated from
+type release struct {
+	Version string `json:"version"`
+	From    string `json:"from,omitempty"`
+	To      string `json:"to"`
+}
+
+// advance moves the checkpoint to commit and records the entry for version
+// as covering the commits since the previous checkpoint
+func (c checkpoint) advance(version, commit string, now time.Time) checkpoint {
+	releases := append([]release{{Version: version, From: c.Commit, To: commit}}, c.Releases...)
+	return checkpoint{Commit: commit, Version: version, UpdatedAt: now, Releases: releases}
+}
+
+// find returns the recorded release of version
+func (c checkpoint) find(version string) (release, bool) {
+	for _, r := range c.Releases {
+		if r.Version == version {
+			return r, true
+		}
+	}
+	return release{}, false
+}
+
+// loadState reads the changelog state. Without a state file, checkpoints
+// are migrated once from the centralized changelog written by earlier
+// versions, which recorded them in the markdown itself.
+func loadState(stateFile, changelogFile string) (*state, error) {
+	data, err := ioutil.ReadFile(stateFile)
+	if err == nil {
+		s := &state{}
+		if err := json.Unmarshal(data, s); err != nil {
+			return nil, fmt.Errorf("error parsing changelog state %s: %v", stateFile, err)
+		}
+		if s.SubProjects == nil {
+			s.SubProjects = make(map[string]checkpoint)
+		}
+		return s, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading changelog state: %v", err)
+	}
+
+	return migrateState(changelogFile)
+}
+
+func (s *state) save(stateFile string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding changelog state: %v", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(stateFile), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("error creating directory for changelog state: %v", err)
+	}
+
+	// Replace the file in one step so an interrupted run can't leave it half written
+	tmp := stateFile + ".tmp"
+	err = ioutil.WriteFile(tmp, append(data, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing changelog state: %v", err)
+	}
+	err = os.Rename(tmp, stateFile)
+	if err != nil {
+		return fmt.Errorf("error writing changelog state: %v", err)
+	}
+	return nil
+}
+
+// migrateState recovers checkpoints from a centralized changelog: the
+// "- Updated to version X | <commit>" line under each "### <subproject>"
+// heading of the latest entry, and its "Commit: <commit>" line.
+func migrateState(changelogFile string) (*state, error) {
+	s := &state{SubProjects: make(map[string]checkpoint)}
+
+	content, err := ioutil.ReadFile(changelogFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("error reading centralized changelog file: %v", err)
+	}
+
+	var subProject string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "### "):
+			subProject = strings.TrimSpace(line[4:])
+		case strings.HasPrefix(line, "- Updated to version") && subProject != "":
+			parts := strings.Split(line, "|")
+			if _, seen := s.SubProjects[subProject]; len(parts) == 2 && !seen {
+				version := strings.TrimSpace(strings.TrimPrefix(parts[0], "- Updated to version"))
+				s.SubProjects[subProject] = checkpoint{Commit: strings.TrimSpace(parts[1]), Version: version}
+			}
+		case strings.HasPrefix(line, "Commit: "):
+			// Builds outside a repository recorded a build number instead
+			if commit := strings.TrimSpace(line[8:]); s.Central == nil {
+				if _, err := stringToHash(commit); err == nil {
+					s.Central = &checkpoint{Commit: commit}
+				}
+			}
+			// Only the latest entry has current checkpoints
+			return s, nil
+		}
+	}
+
+	return s, nil
+}
@@ -0,0 +1,194 @@
+// pkg/changelog/state_test.go
+package changelog
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	hashA       = "1111111111111111111111111111111111111111"
+	hashB       = "2222222222222222222222222222222222222222"
+	hashCentral = "3333333333333333333333333333333333333333"
+	hashOld     = "4444444444444444444444444444444444444444"
+)
+
+// writeChangelog writes a centralized changelog in the format written before
+// the state file existed
+func writeChangelog(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "CHANGELOG.md")
+	if err := ioutil.WriteFile(path, []byte(strings.TrimLeft(content, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMigrateState(t *testing.T) {
+	path := writeChangelog(t, `
+## [1.1.0] - 2024-05-02
+
+### app
+- Updated to version 1.2.0 | `+hashA+`
+### lib
+- Updated to version 0.3.1 | `+hashB+`
+
+### Central Repository
+- Bump versions
+
+Commit: `+hashCentral+`
+Author: Dev <dev@example.com>
+Date: 2024-05-02 10:00:00 +0000 UTC
+Message: Bump versions
+
+## [1.0.0] - 2024-05-01
+
+### app
+- Updated to version 1.1.0 | `+hashOld+`
+### docs
+- Updated to version 0.1.0 | `+hashOld+`
+
+Commit: `+hashOld+`
+`)
+
+	s, err := migrateState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]checkpoint{
+		"app": {Commit: hashA, Version: "1.2.0"},
+		"lib": {Commit: hashB, Version: "0.3.1"},
+	}
+	// docs is only in an older entry, whose checkpoints are stale
+	if !reflect.DeepEqual(s.SubProjects, want) {
+		t.Errorf("subprojects = %+v, want %+v", s.SubProjects, want)
+	}
+	if s.Central == nil || s.Central.Commit != hashCentral {
+		t.Errorf("central = %+v, want commit %s", s.Central, hashCentral)
+	}
+}
+
+func TestMigrateStateOddHeadings(t *testing.T) {
+	path := writeChangelog(t, `
+# Changelog
+
+- Updated to version 9.9.9 | `+hashOld+`
+
+## [1.1.0] - 2024-05-02
+
+###   app   
+  - Updated to version 1.2.0 |   `+hashA+`  
+### app
+- Updated to version 1.1.0 | `+hashOld+`
+### lib (renamed)
+- Updated to version 0.3.1 | `+hashB+`
+### docs
+- Updated to version 0.2.0
+### tools
+- Updated to version 0.4.0 | `+hashA+` | extra
+###web
+- Updated to version 2.0.0 | `+hashB+`
+
+Commit: `+hashCentral+`
+`)
+
+	s, err := migrateState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]checkpoint{
+		// Whitespace around the heading and the line is ignored, and the
+		// first line for a subproject wins
+		"app": {Commit: hashA, Version: "1.2.0"},
+		// Edited headings are taken as written
+		"lib (renamed)": {Commit: hashB, Version: "0.3.1"},
+		// ###web isn't a heading, so its line belongs to tools, whose own
+		// line has no single commit; lines before any heading and without
+		// a commit are ignored
+		"tools": {Commit: hashB, Version: "2.0.0"},
+	}
+	if !reflect.DeepEqual(s.SubProjects, want) {
+		t.Errorf("subprojects = %+v, want %+v", s.SubProjects, want)
+	}
+	if s.Central == nil || s.Central.Commit != hashCentral {
+		t.Errorf("central = %+v, want commit %s", s.Central, hashCentral)
+	}
+}
+
+func TestMigrateStateBuildNumber(t *testing.T) {
+	// Builds outside a repository recorded a build number
+	path := writeChangelog(t, `
+## [1.0.1] - 2024-05-02
+
+### app
+- Updated to version 1.0.1 | `+hashA+`
+
+Commit: 42
+Author: build-host
+
+## [1.0.0] - 2024-05-01
+
+Commit: `+hashOld+`
+`)
+
+	s, err := migrateState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Central != nil {
+		t.Errorf("central = %+v, want none", s.Central)
+	}
+	if want := map[string]checkpoint{"app": {Commit: hashA, Version: "1.0.1"}}; !reflect.DeepEqual(s.SubProjects, want) {
+		t.Errorf("subprojects = %+v, want %+v", s.SubProjects, want)
+	}
+}
+
+func TestMigrateStateWithoutChangelog(t *testing.T) {
+	s, err := migrateState(filepath.Join(t.TempDir(), "CHANGELOG.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Central != nil || s.SubProjects == nil || len(s.SubProjects) != 0 {
+		t.Errorf("state = %+v, want an empty one", s)
+	}
+}
+
+func TestLoadStatePrefersStateFile(t *testing.T) {
+	path := writeChangelog(t, "## [1.0.0] - 2024-05-01\n\n### app\n- Updated to version 1.0.0 | "+hashOld+"\n\nCommit: "+hashOld+"\n")
+	stateFile := filepath.Join(filepath.Dir(path), StateFile)
+
+	// Migrated while there is no state file
+	s, err := loadState(stateFile, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.SubProjects["app"].Commit != hashOld {
+		t.Errorf("migrated app = %+v, want commit %s", s.SubProjects["app"], hashOld)
+	}
+
+	s.SubProjects["app"] = s.SubProjects["app"].advance("1.0.1", hashA, s.SubProjects["app"].UpdatedAt)
+	if err := s.save(stateFile); err != nil {
+		t.Fatal(err)
+	}
+	s, err = loadState(stateFile, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := s.SubProjects["app"]
+	if app.Commit != hashA || app.Version != "1.0.1" {
+		t.Errorf("app = %+v, want 1.0.1 at %s", app, hashA)
+	}
+	if r, ok := app.find("1.0.1"); !ok || r.From != hashOld || r.To != hashA {
+		t.Errorf("release 1.0.1 = %+v, want %s..%s", r, hashOld, hashA)
+	}
+
+	if err := ioutil.WriteFile(stateFile, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadState(stateFile, path); err == nil {
+		t.Error("expected an error for a corrupt state file")
+	}
+}
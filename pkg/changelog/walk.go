@@ -0,0 +1,187 @@
+// pkg/changelog/walk.go
+package changelog
+
+import (
+	"container/heap"
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// commitRange returns the commits reachable from to but not from from,
+// newest first, like `git log from..to`. An empty from selects everything
+// reachable from to. from doesn't have to be an ancestor of to: on diverged
+// branches the range is what to has on top of their merge base.
+//
+// Both sides are walked together, newest commit first, and the walk stops
+// soon after only commits reachable from from are left to visit, so only
+// the history down to the merge base is read.
+func commitRange(repo *git.Repository, from, to string) ([]*object.Commit, error) {
+	toCommit, err := resolveCommit(repo, to)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := make(map[plumbing.Hash]uint8)
+	// Parents of the commits taken from the queue, and the commits in it
+	parents := make(map[plumbing.Hash][]plumbing.Hash)
+	queued := make(map[plumbing.Hash]bool)
+	queue := &commitQueue{}
+	// Number of queued commits not known to be reachable from from
+	interesting := 0
+
+	// markUninteresting flags a commit that turns out to be reachable from
+	// from, along with the ancestors the walk went through already
+	markUninteresting := func(hash plumbing.Hash) {
+		stack := []plumbing.Hash{hash}
+		for len(stack) > 0 {
+			hash := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if old, seen := flags[hash]; !seen || old&uninteresting != 0 {
+				continue
+			}
+			flags[hash] |= uninteresting
+			if queued[hash] {
+				interesting--
+				continue
+			}
+			stack = append(stack, parents[hash]...)
+		}
+	}
+	visit := func(commit *object.Commit, flag uint8) {
+		if _, seen := flags[commit.Hash]; seen {
+			if flag&uninteresting != 0 {
+				markUninteresting(commit.Hash)
+			}
+			return
+		}
+		flags[commit.Hash] = flag
+		queued[commit.Hash] = true
+		if flag&uninteresting == 0 {
+			interesting++
+		}
+		heap.Push(queue, commit)
+	}
+
+	visit(toCommit, 0)
+	if from != "" {
+		fromCommit, err := resolveCommit(repo, from)
+		if err != nil {
+			return nil, err
+		}
+		visit(fromCommit, uninteresting)
+	}
+
+	var commits []*object.Commit
+	slop := walkSlop
+	for queue.Len() > 0 {
+		commit := heap.Pop(queue).(*object.Commit)
+		delete(queued, commit.Hash)
+		parents[commit.Hash] = commit.ParentHashes
+		flag := flags[commit.Hash]
+		if flag&uninteresting == 0 {
+			interesting--
+			commits = append(commits, commit)
+		}
+
+		for _, parentHash := range commit.ParentHashes {
+			if _, seen := flags[parentHash]; seen {
+				// Commits already queued or visited only need to learn that
+				// they are reachable from the excluded side
+				if flag&uninteresting != 0 {
+					markUninteresting(parentHash)
+				}
+				continue
+			}
+			parent, err := repo.CommitObject(parentHash)
+			if err != nil {
+				return nil, fmt.Errorf("error reading commit %s: %v", parentHash, err)
+			}
+			visit(parent, flag)
+		}
+
+		// Once only commits reachable from from are left, keep going while
+		// they are newer than a commit taken, and for a few more, in case
+		// clock skew put an ancestor of from ahead of them
+		switch {
+		case interesting > 0:
+			slop = walkSlop
+		case queue.Len() > 0 && len(commits) > 0 && (*queue)[0].Committer.When.After(commits[len(commits)-1].Committer.When):
+			slop = walkSlop
+		default:
+			slop--
+		}
+		if slop == 0 {
+			break
+		}
+	}
+
+	// With clock skew, a commit can be taken before the walk finds it is
+	// reachable from from after all
+	ranged := commits[:0]
+	for _, commit := range commits {
+		if flags[commit.Hash]&uninteresting == 0 {
+			ranged = append(ranged, commit)
+		}
+	}
+	return ranged, nil
+}
+
+// Commits reachable from the start of a range are excluded from it
+const uninteresting uint8 = 1
+
+// Commits walked past the point where only commits reachable from the start
+// of a range are left, as git does
+const walkSlop = 5
+
+// commitQueue is a heap of commits, newest committer time first
+type commitQueue []*object.Commit
+
+func (q commitQueue) Len() int { return len(q) }
+func (q commitQueue) Less(i, j int) bool {
+	return q[i].Committer.When.After(q[j].Committer.When)
+}
+func (q commitQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x interface{}) { *q = append(*q, x.(*object.Commit)) }
+func (q *commitQueue) Pop() interface{} {
+	old := *q
+	commit := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return commit
+}
+
+// resolveCommit finds the commit a hash, tag, branch or revision expression
+// (HEAD~2) refers to. Like git, names of refs win over abbreviated hashes.
+func resolveCommit(repo *git.Repository, rev string) (*object.Commit, error) {
+	if hash, err := stringToHash(rev); err == nil {
+		return peelCommit(repo, hash, rev)
+	}
+
+	for _, prefix := range []string{"", "refs/", "refs/tags/", "refs/heads/", "refs/remotes/"} {
+		ref, err := repo.Reference(plumbing.ReferenceName(prefix+rev), true)
+		if err == nil {
+			return peelCommit(repo, ref.Hash(), rev)
+		}
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve %s: %v", rev, err)
+	}
+	return peelCommit(repo, *hash, rev)
+}
+
+// peelCommit returns the commit a hash refers to, directly or through an
+// annotated tag
+func peelCommit(repo *git.Repository, hash plumbing.Hash, rev string) (*object.Commit, error) {
+	commit, err := repo.CommitObject(hash)
+	if err == nil {
+		return commit, nil
+	}
+	if tag, tagErr := repo.TagObject(hash); tagErr == nil {
+		return tag.Commit()
+	}
+	return nil, fmt.Errorf("commit not found: %s", rev)
+}
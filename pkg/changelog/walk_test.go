@@ -0,0 +1,112 @@
+// pkg/changelog/walk_test.go
+package changelog
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func walk(t *testing.T, r *testRepo, from, to plumbing.Hash) []string {
+	t.Helper()
+	fromRev := ""
+	if !from.IsZero() {
+		fromRev = from.String()
+	}
+	commits, err := commitRange(r.repo, fromRev, to.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return messages(commits)
+}
+
+func TestCommitRangeLinear(t *testing.T) {
+	r := newTestRepo(t)
+	first := r.commit("first", nil)
+	second := r.commit("second", nil, first)
+	third := r.commit("third", nil, second)
+	fourth := r.commit("fourth", nil, third)
+
+	if got, want := walk(t, r, second, fourth), []string{"fourth", "third"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("commitRange(second, fourth) = %q, want %q", got, want)
+	}
+	if got := walk(t, r, fourth, fourth); len(got) != 0 {
+		t.Errorf("commitRange(fourth, fourth) = %q, want nothing", got)
+	}
+	if got := walk(t, r, fourth, second); len(got) != 0 {
+		t.Errorf("commitRange(fourth, second) = %q, want nothing", got)
+	}
+}
+
+func TestCommitRangeEmptyFrom(t *testing.T) {
+	r := newTestRepo(t)
+	first := r.commit("first", nil)
+	second := r.commit("second", nil, first)
+	third := r.commit("third", nil, second)
+
+	if got, want := walk(t, r, plumbing.ZeroHash, third), []string{"third", "second", "first"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("commitRange(\"\", third) = %q, want %q", got, want)
+	}
+}
+
+func TestCommitRangeDivergedBranches(t *testing.T) {
+	r := newTestRepo(t)
+	base := r.commit("base", nil)
+	ours := r.commit("ours 1", nil, base)
+	theirs := r.commit("theirs 1", nil, base)
+	ours = r.commit("ours 2", nil, ours)
+	theirs = r.commit("theirs 2", nil, theirs)
+
+	if got, want := walk(t, r, theirs, ours), []string{"ours 2", "ours 1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("commitRange(theirs, ours) = %q, want %q", got, want)
+	}
+	if got, want := walk(t, r, ours, theirs), []string{"theirs 2", "theirs 1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("commitRange(ours, theirs) = %q, want %q", got, want)
+	}
+}
+
+func TestCommitRangeMerges(t *testing.T) {
+	r := newTestRepo(t)
+	base := r.commit("base", nil)
+	feature := r.commit("feature", nil, base)
+	main := r.commit("main", nil, base)
+	merge := r.commit("merge", nil, main, feature)
+	after := r.commit("after", nil, merge)
+
+	if got, want := walk(t, r, base, after), []string{"after", "merge", "main", "feature"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("commitRange(base, after) = %q, want %q", got, want)
+	}
+	// The merged branch was released on its own before
+	if got, want := walk(t, r, feature, after), []string{"after", "merge", "main"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("commitRange(feature, after) = %q, want %q", got, want)
+	}
+	if got, want := walk(t, r, merge, after), []string{"after"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("commitRange(merge, after) = %q, want %q", got, want)
+	}
+}
+
+func TestCommitRangeClockSkew(t *testing.T) {
+	r := newTestRepo(t)
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	root := r.commitAt(start, "root", nil)
+	base := r.commitAt(start.Add(10*time.Minute), "base", nil, root)
+	// Committed on a machine whose clock was behind, so it looks older than
+	// its parent
+	skewed := r.commitAt(start.Add(5*time.Minute), "skewed", nil, base)
+	head := r.commitAt(start.Add(20*time.Minute), "head", nil, base)
+
+	if got, want := walk(t, r, skewed, head), []string{"head"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("commitRange(skewed, head) = %q, want %q", got, want)
+	}
+
+	// A longer skewed history behind the merge base
+	older := skewed
+	for i := 1; i <= 3; i++ {
+		older = r.commitAt(start.Add(time.Duration(5-i)*time.Minute), "older", nil, older)
+	}
+	if got, want := walk(t, r, older, head), []string{"head"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("commitRange(older, head) = %q, want %q", got, want)
+	}
+}
@@ -4,6 +4,7 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -15,32 +16,165 @@ type SubProject struct {
 	BuildCmd   []string `yaml:"buildCmd"`
 	Dockerfile string   `yaml:"dockerfile"`
 	DependsOn  []string `yaml:"dependsOn"`
+
+	Env     map[string]string `yaml:"env,omitempty"`
+	EnvFile string            `yaml:"envFile,omitempty"`
+	WorkDir string            `yaml:"workdir,omitempty"`
+
+	// Timeout bounds the whole subproject build, CommandTimeout each command
+	Timeout        time.Duration `yaml:"timeout,omitempty"`
+	CommandTimeout time.Duration `yaml:"commandTimeout,omitempty"`
+	Retries        int           `yaml:"retries,omitempty"`
+	RetryBackoff   time.Duration `yaml:"retryBackoff,omitempty"`
+
+	Steps []Step `yaml:"steps,omitempty"`
+
+	// Outputs are globs, relative to Path, of the files a build produces.
+	// "**" matches any number of directories.
+	Outputs []string `yaml:"outputs,omitempty"`
+
+	// Sandbox runs the build in a temporary copy of the subproject's input
+	// files and its dependencies' outputs, with a scrubbed environment
+	Sandbox bool `yaml:"sandbox,omitempty"`
+
+	// ChangelogTemplate overrides the changelog template for this subproject
+	ChangelogTemplate string `yaml:"changelogTemplate,omitempty"`
+	// ChangelogPaths are more directories, relative to the repository root,
+	// whose commits belong in this subproject's changelog besides Path
+	ChangelogPaths []string `yaml:"changelogPaths,omitempty"`
+}
+
+// Step is a named build command. Steps run phase by phase (pre-build, build,
+// test, package, post-build) and in declaration order within a phase.
+type Step struct {
+	Name            string            `yaml:"name,omitempty"`
+	Phase           string            `yaml:"phase,omitempty"`
+	Run             string            `yaml:"run"`
+	Shell           string            `yaml:"shell,omitempty"`
+	Env             map[string]string `yaml:"env,omitempty"`
+	ContinueOnError bool              `yaml:"continueOnError,omitempty"`
+	If              string            `yaml:"if,omitempty"`
+	Timeout         time.Duration     `yaml:"timeout,omitempty"`
+	// Retries overrides the subproject's retries, including with 0
+	Retries *int `yaml:"retries,omitempty"`
+}
+
+// ChangelogConfig controls how commits are turned into changelog entries.
+// Commits are parsed as conventional commits ("type(scope)!: subject") and
+// grouped into sections by type.
+type ChangelogConfig struct {
+	// Sections maps commit types to section titles, adding to or replacing
+	// the default mapping (feat: Added, fix: Fixed, ...)
+	Sections map[string]string `yaml:"sections,omitempty"`
+	// Exclude lists commit types to leave out of changelogs besides chore,
+	// ci, build, style and test, which Include can bring back
+	Exclude []string `yaml:"exclude,omitempty"`
+	Include []string `yaml:"include,omitempty"`
+	// ExcludePatterns are regular expressions; commits whose subject line
+	// matches any of them are left out
+	ExcludePatterns []string `yaml:"excludePatterns,omitempty"`
+	// IncludeMerges keeps merge commits, which are left out by default
+	IncludeMerges bool `yaml:"includeMerges,omitempty"`
+
+	// Template and CentralTemplate are paths to text/template files that
+	// replace the built-in templates for subproject and central entries
+	Template        string `yaml:"template,omitempty"`
+	CentralTemplate string `yaml:"centralTemplate,omitempty"`
+	// CommitURL and CompareURL link commits and releases, e.g.
+	// https://github.com/org/repo/commit/{hash} and .../compare/{from}...{to}
+	CommitURL  string `yaml:"commitURL,omitempty"`
+	CompareURL string `yaml:"compareURL,omitempty"`
+	// IssueURL links "#123" references, e.g.
+	// https://github.com/org/repo/issues/{id}, and TrackerURL issue keys
+	// such as "JIRA-456", e.g. https://jira.example.com/browse/{id}
+	IssueURL   string `yaml:"issueURL,omitempty"`
+	TrackerURL string `yaml:"trackerURL,omitempty"`
+	// IssueKeys are the projects (JIRA, OPS, ...) whose issue keys are
+	// picked up. Without any, only "#123" issues are, so that words like
+	// UTF-8 aren't taken for issues.
+	IssueKeys []string `yaml:"issueKeys,omitempty"`
+	// NotesTemplate replaces the built-in release notes template
+	NotesTemplate string `yaml:"notesTemplate,omitempty"`
+	// Formats are the formats changelogs are written in: markdown (the
+	// default), asciidoc, json or yaml
+	Formats []string `yaml:"formats,omitempty"`
+	// Aggregate puts the changes of each updated subproject in the central
+	// entry, after a table of their version changes
+	Aggregate bool `yaml:"aggregate,omitempty"`
 }
 
 type Config struct {
-	Name       string   `yaml:"name"`
-	Version    string   `yaml:"version"`
-	SubProjects []SubProject `yaml:"subProjects"`
+	Name        string                   `yaml:"name"`
+	Version     string                   `yaml:"version"`
+	SubProjects []SubProject             `yaml:"subProjects"`
+	Profiles    map[string]yaml.MapSlice `yaml:"profiles,omitempty"`
+	Changelog   ChangelogConfig          `yaml:"changelog,omitempty"`
+
+	// Profile is the name of the profile applied by ParseConfig, if any
+	Profile string `yaml:"-"`
+	// File is the path ParseConfig read the configuration from
+	File string `yaml:"-"`
+
+	// source is the configuration as written on disk, before interpolation
+	// and profile overrides, so SaveConfig doesn't persist resolved values
+	source *rawValue
 }
 
-func ParseConfig(configFile string) (*Config, error) {
+func ParseConfig(configFile string, profile string) (*Config, error) {
 	data, err := ioutil.ReadFile(configFile)
 	if err != nil {
 		return nil, fmt.Errorf("error reading config file: %v", err)
 	}
 
+	var source rawValue
+	err = yaml.Unmarshal(data, &source)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file: %v", err)
+	}
+
+	// Environment variables are expanded in the document before it is
+	// decoded, so that fields of every type can use them
+	resolved, err := interpolateDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("error interpolating config file: %v", err)
+	}
 	var config Config
-	err = yaml.Unmarshal(data, &config)
+	err = yaml.Unmarshal(resolved, &config)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing config file: %v", err)
 	}
 
+	if profile != "" {
+		err = applyProfile(&config, profile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	config.Profile = profile
+	config.File = configFile
+	config.source = &source
+
 	return &config, nil
 }
 
-
 func SaveConfig(configFile string, config *Config) error {
-	data, err := yaml.Marshal(config)
+	var data []byte
+	var err error
+	if config.source != nil {
+		// Only versions are written back, everything else keeps its
+		// original form. Subprojects are listed in the same order.
+		config.source.set("version", config.Version)
+		if subProjects := config.source.mapping["subProjects"]; subProjects != nil {
+			for i, subProject := range subProjects.sequence {
+				if i < len(config.SubProjects) {
+					subProject.set("version", config.SubProjects[i].Version)
+				}
+			}
+		}
+		data, err = config.source.marshal()
+	} else {
+		data, err = yaml.Marshal(config)
+	}
 	if err != nil {
 		return fmt.Errorf("error marshaling config: %v", err)
 	}
@@ -51,4 +185,13 @@ func SaveConfig(configFile string, config *Config) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+func (c *Config) GetSubProject(name string) *SubProject {
+	for i := range c.SubProjects {
+		if c.SubProjects[i].Name == name {
+			return &c.SubProjects[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// pkg/config/interpolate.go
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Matches $${...} (an escaped placeholder), ${VAR}, ${VAR:-default} and
+// ${VAR:?message}
+var placeholderPattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(?:(:-|:\?)([^}]*))?\}`)
+
+// Keys whose values are shell commands. They are left to the shell, which
+// expands ${VAR} itself from the build environment.
+var commandKeys = map[string]bool{"buildCmd": true, "run": true}
+
+// interpolateDocument expands environment variable placeholders in the
+// scalar values of a YAML document, before it is decoded, so that fields of
+// any type can use them: `timeout: ${TIMEOUT:-5m}` decodes into a duration
+// and `retries: ${RETRIES:-1}` into an int. Commands are left alone.
+func interpolateDocument(data []byte) ([]byte, error) {
+	var doc rawValue
+	err := yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+	err = doc.interpolate()
+	if err != nil {
+		return nil, err
+	}
+	return doc.marshal()
+}
+
+// interpolate expands the placeholders in every scalar outside commands
+func (v *rawValue) interpolate() error {
+	if v == nil {
+		return nil
+	}
+	for _, key := range v.keys {
+		if commandKeys[key] {
+			continue
+		}
+		if err := v.mapping[key].interpolate(); err != nil {
+			return err
+		}
+	}
+	for _, value := range v.sequence {
+		if err := value.interpolate(); err != nil {
+			return err
+		}
+	}
+	if v.null || !strings.Contains(v.scalar, "${") {
+		return nil
+	}
+
+	s, err := Interpolate(v.scalar)
+	if err != nil {
+		return err
+	}
+	// The value resolves as if it had been written in place of the
+	// placeholder, as long as it is a plain scalar
+	v.scalar, v.typed = s, false
+	var resolved interface{}
+	if yaml.Unmarshal([]byte(s), &resolved) == nil {
+		switch resolved.(type) {
+		case nil, string, map[interface{}]interface{}, []interface{}:
+		default:
+			v.typed = true
+		}
+	}
+	return nil
+}
+
+// Interpolate replaces ${VAR}, ${VAR:-default} and ${VAR:?message} with
+// values from the environment. ${VAR} fails when VAR is unset; the default
+// is used, or ${VAR:?message} fails with message, when VAR is unset or
+// empty. $${ produces a literal ${.
+func Interpolate(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var err error
+	result := placeholderPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+		parts := placeholderPattern.FindStringSubmatch(match)
+		name, operator, arg := parts[1], parts[2], parts[3]
+		value, set := os.LookupEnv(name)
+		switch {
+		case operator == "" && !set:
+			if err == nil {
+				err = fmt.Errorf("environment variable %s is not set (use ${%s:-} to allow an empty value)", name, name)
+			}
+		case operator == ":-" && value == "":
+			return arg
+		case operator == ":?" && value == "":
+			if arg == "" {
+				arg = "not set or empty"
+			}
+			if err == nil {
+				err = fmt.Errorf("environment variable %s: %s", name, arg)
+			}
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
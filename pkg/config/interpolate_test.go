@@ -0,0 +1,169 @@
+// pkg/config/interpolate_test.go
+package config
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInterpolate(t *testing.T) {
+	t.Setenv("BUILDY_SET", "value")
+	t.Setenv("BUILDY_EMPTY", "")
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "plain"},
+		{"${BUILDY_SET}/x", "value/x"},
+		{"${BUILDY_EMPTY}", ""},
+		{"${BUILDY_UNSET:-fallback}", "fallback"},
+		{"${BUILDY_EMPTY:-fallback}", "fallback"},
+		{"${BUILDY_UNSET:-}", ""},
+		{"${BUILDY_SET:?required}", "value"},
+		{"$${BUILDY_SET}", "${BUILDY_SET}"},
+	}
+	for _, test := range tests {
+		got, err := Interpolate(test.in)
+		if err != nil {
+			t.Errorf("Interpolate(%q): %v", test.in, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Interpolate(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestInterpolateErrors(t *testing.T) {
+	t.Setenv("BUILDY_EMPTY", "")
+
+	for _, in := range []string{"${BUILDY_UNSET}", "a ${BUILDY_UNSET} b", "${BUILDY_UNSET:?}", "${BUILDY_EMPTY:?must be set}"} {
+		if got, err := Interpolate(in); err == nil {
+			t.Errorf("Interpolate(%q) = %q, want an error", in, got)
+		}
+	}
+}
+
+func TestParseConfigUnsetVariable(t *testing.T) {
+	config := `name: central
+version: 1.0.0
+subProjects:
+  - name: a
+    version: 1.0.0
+    path: ${BUILDY_UNSET_PATH}
+`
+	if _, err := ParseConfig(writeConfig(t, config), ""); err == nil {
+		t.Fatal("expected an error for an unset variable without a default")
+	}
+}
+
+func TestParseConfigTypedFields(t *testing.T) {
+	t.Setenv("BUILDY_RETRIES", "3")
+	config := `name: central
+version: ${BUILDY_CENTRAL_VERSION:-1.10}
+subProjects:
+  - name: a
+    version: 1.0.0
+    path: ./a
+    timeout: ${BUILDY_TIMEOUT:-5m}
+    retries: ${BUILDY_RETRIES}
+    sandbox: ${BUILDY_SANDBOX:-true}
+    env:
+      PORT: ${BUILDY_PORT:-8080}
+      NAME: "${BUILDY_NAME:-a: b}"
+`
+	cfg, err := ParseConfig(writeConfig(t, config), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := cfg.SubProjects[0]
+	if cfg.Version != "1.10" || a.Timeout != 5*time.Minute || a.Retries != 3 || !a.Sandbox {
+		t.Errorf("version %q, timeout %s, retries %d, sandbox %v", cfg.Version, a.Timeout, a.Retries, a.Sandbox)
+	}
+	if a.Env["PORT"] != "8080" || a.Env["NAME"] != "a: b" {
+		t.Errorf("env = %q", a.Env)
+	}
+
+	config += `profiles:
+  ci:
+    subProjects:
+      - name: a
+        timeout: ${BUILDY_CI_TIMEOUT:-1m}
+`
+	cfg, err = ParseConfig(writeConfig(t, config), "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SubProjects[0].Timeout != time.Minute {
+		t.Errorf("profile timeout = %s, want 1m", cfg.SubProjects[0].Timeout)
+	}
+}
+
+func TestParseConfigLeavesCommands(t *testing.T) {
+	config := `name: central
+version: 1.0.0
+subProjects:
+  - name: a
+    version: 1.0.0
+    path: ./a
+    env:
+      IMAGE: foo
+    buildCmd:
+      - docker push ${IMAGE}:${BUILDY_VERSION}
+    steps:
+      - name: test
+        run: echo "${BUILDY_UNSET_IN_RUN:-none}" $${X}
+        if: env.CI
+`
+	cfg, err := ParseConfig(writeConfig(t, config), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := cfg.SubProjects[0]
+	if a.BuildCmd[0] != "docker push ${IMAGE}:${BUILDY_VERSION}" {
+		t.Errorf("buildCmd = %q", a.BuildCmd)
+	}
+	if a.Steps[0].Run != `echo "${BUILDY_UNSET_IN_RUN:-none}" $${X}` {
+		t.Errorf("run = %q", a.Steps[0].Run)
+	}
+}
+
+func TestSaveConfigKeepsPlaceholders(t *testing.T) {
+	// In the layout the config is saved in
+	config := `name: central
+version: 1.10.0
+subProjects:
+- name: a
+  version: 1.0.0
+  path: ${BUILDY_A_PATH:-./a}
+  timeout: ${BUILDY_TIMEOUT:-5m}
+  retries: 2
+  buildCmd:
+  - make VERSION=${BUILDY_VERSION}
+- name: b
+  version: 2.0.0
+  path: ./b
+`
+	file := writeConfig(t, config)
+	cfg, err := ParseConfig(file, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Version = "1.10.1"
+	cfg.SubProjects[1].Version = "2.0.1"
+	if err := SaveConfig(file, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.NewReplacer("version: 1.10.0", "version: 1.10.1", "version: 2.0.0", "version: 2.0.1").Replace(config)
+	if string(data) != want {
+		t.Errorf("saved config:\n%s\nwant:\n%s", data, want)
+	}
+}
@@ -0,0 +1,99 @@
+// pkg/config/profile.go
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// applyProfile overlays the named profile onto the config. Any field set in
+// the profile replaces the base value, even with false, 0 or ""; nested
+// settings such as changelog are overlaid key by key and subprojects are
+// matched by name. Versions are never overridden since they are bumped and
+// saved by buildy.
+func applyProfile(config *Config, name string) error {
+	raw, ok := config.Profiles[name]
+	if !ok {
+		return fmt.Errorf("profile %q not found in config file", name)
+	}
+
+	// Profiles are kept as raw YAML so saving the config writes them back
+	// exactly as they were; decode this one into the config shape to apply it
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("error reading profile %q: %v", name, err)
+	}
+	var profile Config
+	err = yaml.UnmarshalStrict(data, &profile)
+	if err != nil {
+		return fmt.Errorf("error parsing profile %q: %v", name, err)
+	}
+
+	// The keys written in the profile tell which fields it sets, since a
+	// decoded false, 0 or "" looks the same as a field left out
+	var keys map[interface{}]interface{}
+	err = yaml.Unmarshal(data, &keys)
+	if err != nil {
+		return fmt.Errorf("error parsing profile %q: %v", name, err)
+	}
+
+	overlay(reflect.ValueOf(config).Elem(), reflect.ValueOf(&profile).Elem(), keys, "profiles", "subProjects")
+
+	subProjectKeys, _ := keys["subProjects"].([]interface{})
+
+	for i, override := range profile.SubProjects {
+		subProject := config.GetSubProject(override.Name)
+		if subProject == nil {
+			return fmt.Errorf("profile %q overrides unknown subproject %q", name, override.Name)
+		}
+		fields, _ := subProjectKeys[i].(map[interface{}]interface{})
+		overlay(reflect.ValueOf(subProject).Elem(), reflect.ValueOf(&override).Elem(), fields)
+	}
+
+	return nil
+}
+
+// overlay copies the fields of src whose keys are set in keys onto dst,
+// except the name, the version and the keys listed in skip. Struct fields
+// set to a mapping are overlaid recursively.
+func overlay(dst, src reflect.Value, keys map[interface{}]interface{}, skip ...string) {
+	skip = append(skip, "name", "version")
+
+	for i := 0; i < src.NumField(); i++ {
+		field := src.Type().Field(i)
+		key := yamlKey(field)
+		if field.PkgPath != "" || key == "-" || contains(skip, key) {
+			continue
+		}
+		value, ok := keys[key]
+		if !ok {
+			continue
+		}
+		if nested, ok := value.(map[interface{}]interface{}); ok && field.Type.Kind() == reflect.Struct {
+			overlay(dst.Field(i), src.Field(i), nested)
+			continue
+		}
+		dst.Field(i).Set(src.Field(i))
+	}
+}
+
+// yamlKey returns the key a struct field is read from, as yaml.v2 does
+func yamlKey(field reflect.StructField) string {
+	key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if key == "" {
+		return strings.ToLower(field.Name)
+	}
+	return key
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
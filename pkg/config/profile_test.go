@@ -0,0 +1,88 @@
+// pkg/config/profile_test.go
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const profileConfig = `name: central
+version: 1.0.0
+subProjects:
+  - name: a
+    version: 1.2.3
+    path: ./a
+    buildCmd: ["make"]
+    sandbox: true
+    retries: 2
+    timeout: 5m
+    env:
+      MODE: debug
+changelog:
+  aggregate: true
+  commitURL: https://example.com/{hash}
+profiles:
+  ci:
+    changelog:
+      aggregate: false
+    subProjects:
+      - name: a
+        version: 9.9.9
+        sandbox: false
+        retries: 0
+        env: {}
+`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "buildy.yaml")
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestProfileOverridesWithZeroValues(t *testing.T) {
+	cfg, err := ParseConfig(writeConfig(t, profileConfig), "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := cfg.GetSubProject("a")
+	if a.Sandbox {
+		t.Errorf("sandbox = true, want false from the profile")
+	}
+	if a.Retries != 0 {
+		t.Errorf("retries = %d, want 0 from the profile", a.Retries)
+	}
+	if len(a.Env) != 0 {
+		t.Errorf("env = %v, want empty from the profile", a.Env)
+	}
+	if a.Version != "1.2.3" {
+		t.Errorf("version = %s, profiles must not override versions", a.Version)
+	}
+	// Keys the profile leaves out keep their base values
+	if a.Timeout != 5*time.Minute || a.Path != "./a" {
+		t.Errorf("timeout = %v, path = %s, want the base values", a.Timeout, a.Path)
+	}
+
+	if cfg.Changelog.Aggregate {
+		t.Errorf("changelog.aggregate = true, want false from the profile")
+	}
+	if cfg.Changelog.CommitURL != "https://example.com/{hash}" {
+		t.Errorf("changelog.commitURL = %q, want the base value", cfg.Changelog.CommitURL)
+	}
+}
+
+func TestProfileUnknownSubProject(t *testing.T) {
+	config := profileConfig + `  bad:
+    subProjects:
+      - name: b
+        sandbox: true
+`
+	if _, err := ParseConfig(writeConfig(t, config), "bad"); err == nil {
+		t.Fatal("expected an error for a profile overriding an unknown subproject")
+	}
+}
@@ -0,0 +1,133 @@
+// pkg/config/raw.go
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// rawValue is a YAML value whose scalars keep their text as written, which
+// decoding into interface{} would lose: 1.10 would become 1.1. Mappings keep
+// the order of their keys.
+type rawValue struct {
+	keys     []string
+	mapping  map[string]*rawValue
+	sequence []*rawValue
+	scalar   string
+	// typed scalars resolve to something else than a string, such as a
+	// number or a boolean, and null ones to nothing
+	typed, null bool
+}
+
+func (v *rawValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var resolved interface{}
+	err := unmarshal(&resolved)
+	if err != nil {
+		return err
+	}
+
+	switch resolved.(type) {
+	case map[interface{}]interface{}:
+		err = unmarshal(&v.mapping)
+		if err != nil {
+			return err
+		}
+		// Keys in the order they are written, then any whose text differs
+		// from how they resolve
+		var ordered yaml.MapSlice
+		err = unmarshal(&ordered)
+		if err != nil {
+			return err
+		}
+		seen := make(map[string]bool)
+		for _, item := range ordered {
+			key := fmt.Sprint(item.Key)
+			if _, ok := v.mapping[key]; ok && !seen[key] {
+				seen[key] = true
+				v.keys = append(v.keys, key)
+			}
+		}
+		var rest []string
+		for key := range v.mapping {
+			if !seen[key] {
+				rest = append(rest, key)
+			}
+		}
+		sort.Strings(rest)
+		v.keys = append(v.keys, rest...)
+		return nil
+	case []interface{}:
+		return unmarshal(&v.sequence)
+	case nil:
+		v.null = true
+		return nil
+	case string:
+	default:
+		v.typed = true
+	}
+	// Decoding into a string keeps the scalar's text
+	return unmarshal(&v.scalar)
+}
+
+// set replaces the value of key in a mapping with a string
+func (v *rawValue) set(key, value string) {
+	if v == nil || v.mapping == nil {
+		return
+	}
+	if _, ok := v.mapping[key]; !ok {
+		v.keys = append(v.keys, key)
+	}
+	v.mapping[key] = &rawValue{scalar: value}
+}
+
+// marshal writes v back as YAML, with every typed scalar as it was written
+func (v *rawValue) marshal() ([]byte, error) {
+	// Typed scalars are written as tokens that can't be mistaken for
+	// anything else in the document, then replaced with their text
+	var plain []string
+	token := func(text string) string {
+		plain = append(plain, text)
+		return fmt.Sprintf("__buildy_scalar_%d__", len(plain)-1)
+	}
+	data, err := yaml.Marshal(v.encode(token))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Count(data, []byte("__buildy_scalar_")) != len(plain) {
+		return nil, fmt.Errorf("document contains __buildy_scalar_ already")
+	}
+
+	replacements := make([]string, 0, 2*len(plain))
+	for i, text := range plain {
+		replacements = append(replacements, fmt.Sprintf("__buildy_scalar_%d__", i), text)
+	}
+	return []byte(strings.NewReplacer(replacements...).Replace(string(data))), nil
+}
+
+// encode returns v in the form yaml.Marshal writes, with typed scalars
+// replaced by what plain returns for their text
+func (v *rawValue) encode(plain func(string) string) interface{} {
+	switch {
+	case v == nil || v.null:
+		return nil
+	case v.mapping != nil:
+		mapping := make(yaml.MapSlice, 0, len(v.keys))
+		for _, key := range v.keys {
+			mapping = append(mapping, yaml.MapItem{Key: key, Value: v.mapping[key].encode(plain)})
+		}
+		return mapping
+	case v.sequence != nil:
+		sequence := make([]interface{}, len(v.sequence))
+		for i, value := range v.sequence {
+			sequence[i] = value.encode(plain)
+		}
+		return sequence
+	case v.typed:
+		return plain(v.scalar)
+	}
+	return v.scalar
+}
@@ -1,7 +1,12 @@
 // pkg/graph/graph.go
 package graph
 
-import "buildy/pkg/config"
+import (
+	"fmt"
+	"strings"
+
+	"buildy/pkg/config"
+)
 
 type Graph map[string][]string
 
@@ -35,4 +40,44 @@ func (g Graph) GetSubprojectsToBuild(changedSubprojects []string) []string {
 	}
 
 	return result
-}
\ No newline at end of file
+}
+
+// TopologicalOrder returns the subprojects ordered so that each one comes
+// after everything it depends on, keeping the configured order otherwise.
+func TopologicalOrder(subProjects []config.SubProject) ([]string, error) {
+	graph := BuildDependencyGraph(subProjects)
+	var result []string
+	state := make(map[string]int) // 1 = visiting, 2 = done
+
+	var visit func(subProject string, path []string) error
+	visit = func(subProject string, path []string) error {
+		switch state[subProject] {
+		case 1:
+			return fmt.Errorf("dependency cycle: %s -> %s", strings.Join(path, " -> "), subProject)
+		case 2:
+			return nil
+		}
+		dependencies, ok := graph[subProject]
+		if !ok {
+			return fmt.Errorf("%s depends on unknown subproject %s", path[len(path)-1], subProject)
+		}
+
+		state[subProject] = 1
+		for _, dependency := range dependencies {
+			if err := visit(dependency, append(path, subProject)); err != nil {
+				return err
+			}
+		}
+		state[subProject] = 2
+		result = append(result, subProject)
+		return nil
+	}
+
+	for _, subProject := range subProjects {
+		if err := visit(subProject.Name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,61 @@
+// pkg/graph/graph_test.go
+package graph
+
+import (
+	"reflect"
+	"testing"
+
+	"buildy/pkg/config"
+)
+
+func subProjects(dependencies ...[]string) []config.SubProject {
+	var result []config.SubProject
+	for _, names := range dependencies {
+		result = append(result, config.SubProject{Name: names[0], DependsOn: names[1:]})
+	}
+	return result
+}
+
+func TestTopologicalOrder(t *testing.T) {
+	tests := []struct {
+		name        string
+		subProjects []config.SubProject
+		want        []string
+	}{
+		{"empty", nil, nil},
+		{"independent keep configured order", subProjects([]string{"b"}, []string{"a"}, []string{"c"}), []string{"b", "a", "c"}},
+		{"dependency moves first", subProjects([]string{"app", "lib"}, []string{"lib"}), []string{"lib", "app"}},
+		{"chain", subProjects([]string{"c", "b"}, []string{"b", "a"}, []string{"a"}), []string{"a", "b", "c"}},
+		{"diamond", subProjects([]string{"d", "b", "c"}, []string{"b", "a"}, []string{"c", "a"}, []string{"a"}), []string{"a", "b", "c", "d"}},
+		{"shared dependency once", subProjects([]string{"x", "lib"}, []string{"y", "lib"}, []string{"lib"}), []string{"lib", "x", "y"}},
+	}
+	for _, test := range tests {
+		got, err := TopologicalOrder(test.subProjects)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: TopologicalOrder = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTopologicalOrderErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		subProjects []config.SubProject
+		want        string
+	}{
+		{"self", subProjects([]string{"a", "a"}), "dependency cycle: a -> a"},
+		{"cycle", subProjects([]string{"a", "b"}, []string{"b", "c"}, []string{"c", "a"}), "dependency cycle: a -> b -> c -> a"},
+		{"cycle behind a dependency", subProjects([]string{"app", "a"}, []string{"a", "b"}, []string{"b", "a"}), "dependency cycle: app -> a -> b -> a"},
+		{"unknown", subProjects([]string{"app", "lib"}), "app depends on unknown subproject lib"},
+	}
+	for _, test := range tests {
+		got, err := TopologicalOrder(test.subProjects)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%s: TopologicalOrder = %q, %v, want error %q", test.name, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// pkg/history/history.go
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"buildy/pkg/reporting"
+)
+
+// The history is an append-only JSON Lines file, one BuildReport per build
+const historyFile = "history.jsonl"
+
+func Append(outputDir string, report *reporting.BuildReport) error {
+	err := os.MkdirAll(outputDir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("error creating output directory: %v", err)
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("error encoding build report: %v", err)
+	}
+
+	file, err := os.OpenFile(filepath.Join(outputDir, historyFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening build history: %v", err)
+	}
+
+	_, err = file.Write(append(data, '\n'))
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("error writing build history: %v", err)
+	}
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("error writing build history: %v", err)
+	}
+	return nil
+}
+
+// Load returns the last n builds from the history, oldest first, or all of
+// them when n <= 0. Lines that can't be decoded, such as one cut short by a
+// crash, are skipped.
+func Load(outputDir string, n int) ([]reporting.BuildReport, error) {
+	file, err := os.Open(filepath.Join(outputDir, historyFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening build history: %v", err)
+	}
+	defer file.Close()
+
+	var reports []reporting.BuildReport
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var report reporting.BuildReport
+		if err := json.Unmarshal(scanner.Bytes(), &report); err != nil {
+			continue
+		}
+		reports = append(reports, report)
+		if n > 0 && len(reports) > n {
+			reports = reports[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading build history: %v", err)
+	}
+
+	return reports, nil
+}
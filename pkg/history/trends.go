@@ -0,0 +1,150 @@
+// pkg/history/trends.go
+package history
+
+import (
+	"sort"
+	"time"
+
+	"buildy/pkg/build"
+	"buildy/pkg/reporting"
+)
+
+// Duration increases smaller than this are never reported as regressions
+const minRegression = time.Second
+
+type Trend struct {
+	Name string
+	// Statuses holds one mark per build, oldest first: P passed, F failed,
+	// C was cached, - didn't run (cancelled, skipped or not in that build)
+	Statuses string
+	Runs     int
+	Passes   int
+	Failures int
+	// Flips counts changes between passing and failing
+	Flips int
+	// Retried counts passing builds in which a step only passed on retry
+	Retried int
+	Flaky   bool
+
+	// LatestPassingDuration is the duration of the latest passing build, and
+	// MedianDuration the median of the passing builds before it. Failed and
+	// cached builds don't count, as they stop early or run no steps.
+	LatestPassingDuration time.Duration
+	MedianDuration        time.Duration
+	Regression            bool
+}
+
+func (t Trend) PassRate() float64 {
+	if t.Passes+t.Failures == 0 {
+		return 0
+	}
+	return float64(t.Passes) / float64(t.Passes+t.Failures)
+}
+
+// Analyze computes a trend per subproject over the given builds, oldest
+// first. A subproject is flaky when it flipped between passing and failing
+// more than once or only passed on retry. Its latest passing build is a
+// regression when it took more than (1 + threshold) times the median of the
+// earlier passing builds.
+func Analyze(reports []reporting.BuildReport, threshold float64) []Trend {
+	var names []string
+	trends := make(map[string]*Trend)
+	durations := make(map[string][]time.Duration)
+	last := make(map[string]string)
+
+	for i, report := range reports {
+		seen := make(map[string]bool)
+		for _, subProject := range report.SubProjects {
+			trend, ok := trends[subProject.Name]
+			if !ok {
+				trend = &Trend{Name: subProject.Name}
+				for j := 0; j < i; j++ {
+					trend.Statuses += "-"
+				}
+				trends[subProject.Name] = trend
+				names = append(names, subProject.Name)
+			}
+			seen[subProject.Name] = true
+
+			outcome := outcome(subProject.Status)
+			trend.Statuses += outcome
+			switch outcome {
+			case "P":
+				trend.Runs++
+				trend.Passes++
+				if retried(subProject) {
+					trend.Retried++
+				}
+			case "F":
+				trend.Runs++
+				trend.Failures++
+			}
+			if (outcome == "P" || outcome == "F") && last[subProject.Name] != "" && last[subProject.Name] != outcome {
+				trend.Flips++
+			}
+			if outcome == "P" || outcome == "F" {
+				last[subProject.Name] = outcome
+			}
+
+			if outcome == "P" {
+				durations[subProject.Name] = append(durations[subProject.Name], time.Duration(subProject.Duration))
+			}
+		}
+		for name, trend := range trends {
+			if !seen[name] {
+				trend.Statuses += "-"
+			}
+		}
+	}
+
+	result := make([]Trend, 0, len(names))
+	for _, name := range names {
+		trend := trends[name]
+		trend.Flaky = trend.Flips > 1 || trend.Retried > 0
+
+		if d := durations[name]; len(d) > 0 {
+			trend.LatestPassingDuration = d[len(d)-1]
+			if len(d) > 1 {
+				trend.MedianDuration = median(d[:len(d)-1])
+				limit := time.Duration(float64(trend.MedianDuration) * (1 + threshold))
+				trend.Regression = trend.LatestPassingDuration > limit && trend.LatestPassingDuration-trend.MedianDuration >= minRegression
+			}
+		}
+		result = append(result, *trend)
+	}
+
+	return result
+}
+
+func outcome(status string) string {
+	switch status {
+	case build.StatusSuccess:
+		return "P"
+	case build.StatusCached:
+		return "C"
+	case build.StatusFailure, build.StatusTimedOut:
+		return "F"
+	default:
+		return "-"
+	}
+}
+
+func retried(subProject reporting.SubProjectReport) bool {
+	for _, step := range subProject.Steps {
+		if step.Attempts > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func median(durations []time.Duration) time.Duration {
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
@@ -0,0 +1,59 @@
+// pkg/history/trends_test.go
+package history
+
+import (
+	"testing"
+	"time"
+
+	"buildy/pkg/reporting"
+)
+
+func buildOf(status string, duration time.Duration) reporting.BuildReport {
+	return reporting.BuildReport{SubProjects: []reporting.SubProjectReport{
+		{Name: "a", Status: status, Duration: reporting.Duration(duration)},
+	}}
+}
+
+func TestAnalyzeDurationsOfPassingBuilds(t *testing.T) {
+	reports := []reporting.BuildReport{
+		buildOf("Success", 10*time.Second),
+		buildOf("Success", 12*time.Second),
+		buildOf("Success", 30*time.Second),
+		// A failure stops early and must not hide the slow passing build
+		buildOf("Failure", time.Second),
+		buildOf("Cached", 0),
+	}
+
+	trends := Analyze(reports, 0.5)
+	if len(trends) != 1 {
+		t.Fatalf("%d trends, want 1", len(trends))
+	}
+	trend := trends[0]
+	if trend.Statuses != "PPPFC" {
+		t.Errorf("statuses = %s, want PPPFC", trend.Statuses)
+	}
+	if trend.LatestPassingDuration != 30*time.Second {
+		t.Errorf("latest passing duration = %s, want 30s", trend.LatestPassingDuration)
+	}
+	if trend.MedianDuration != 11*time.Second {
+		t.Errorf("median duration = %s, want 11s", trend.MedianDuration)
+	}
+	if !trend.Regression {
+		t.Error("30s against a median of 11s is not reported as a regression")
+	}
+}
+
+func TestAnalyzeFlaky(t *testing.T) {
+	reports := []reporting.BuildReport{
+		buildOf("Success", time.Second),
+		buildOf("Failure", time.Second),
+		buildOf("Success", time.Second),
+	}
+	trend := Analyze(reports, 0.5)[0]
+	if trend.Flips != 2 || !trend.Flaky {
+		t.Errorf("flips = %d, flaky = %v, want 2 and flaky", trend.Flips, trend.Flaky)
+	}
+	if trend.Passes != 2 || trend.Failures != 1 {
+		t.Errorf("passes = %d, failures = %d", trend.Passes, trend.Failures)
+	}
+}
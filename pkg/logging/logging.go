@@ -2,25 +2,219 @@
 package logging
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	if strings.EqualFold(s, "warning") {
+		return LevelWarn, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q (expected one of %s)", s, strings.Join(levelNames, ", "))
+}
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Logger keeps the familiar logger.Info.Printf API: each level is a
+// *log.Logger whose lines are filtered by the minimum level and written as
+// text or JSON along with the logger's fields.
 type Logger struct {
+	Debug *log.Logger
 	Info  *log.Logger
 	Warn  *log.Logger
 	Error *log.Logger
+
+	core   *core
+	fields []field
+}
+
+// core is shared by a logger and all loggers derived from it with With
+type core struct {
+	mu     sync.Mutex
+	output io.Writer
+	level  Level
+	format string
+}
+
+type field struct {
+	key   string
+	value interface{}
 }
 
 func NewLogger(output io.Writer) *Logger {
-	return &Logger{
-		Info:  log.New(output, "[INFO] ", log.Ldate|log.Ltime),
-		Warn:  log.New(output, "[WARN] ", log.Ldate|log.Ltime),
-		Error: log.New(output, "[ERROR] ", log.Ldate|log.Ltime),
-	}
+	return newLogger(&core{output: output, level: LevelInfo, format: FormatText}, nil)
 }
 
 func NewDefaultLogger() *Logger {
 	return NewLogger(os.Stdout)
 }
+
+func newLogger(c *core, fields []field) *Logger {
+	l := &Logger{core: c, fields: fields}
+	l.Debug = log.New(&levelWriter{logger: l, level: LevelDebug}, "", 0)
+	l.Info = log.New(&levelWriter{logger: l, level: LevelInfo}, "", 0)
+	l.Warn = log.New(&levelWriter{logger: l, level: LevelWarn}, "", 0)
+	l.Error = log.New(&levelWriter{logger: l, level: LevelError}, "", 0)
+	return l
+}
+
+// With returns a logger that adds the given key-value pairs to every line.
+// Level and format changes apply to both loggers.
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+	fields := make([]field, len(l.fields), len(l.fields)+len(keysAndValues)/2)
+	copy(fields, l.fields)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key := fmt.Sprint(keysAndValues[i])
+		var value interface{} = "(missing)"
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+		fields = append(fields, field{key, value})
+	}
+	return newLogger(l.core, fields)
+}
+
+// SetLevel drops lines below level, which is info by default
+func (l *Logger) SetLevel(level Level) {
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+	l.core.level = level
+}
+
+func (l *Logger) SetFormat(format string) error {
+	if format != FormatText && format != FormatJSON {
+		return fmt.Errorf("unknown log format %q (expected %s or %s)", format, FormatText, FormatJSON)
+	}
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+	l.core.format = format
+	return nil
+}
+
+// SetOutput redirects the logger and all loggers derived from it
+func (l *Logger) SetOutput(output io.Writer) {
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+	l.core.output = output
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+	return level >= l.core.level
+}
+
+// levelWriter receives one message per call from its *log.Logger
+type levelWriter struct {
+	logger *Logger
+	level  Level
+}
+
+func (w *levelWriter) Write(p []byte) (int, error) {
+	c := w.logger.core
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if w.level < c.level {
+		return len(p), nil
+	}
+
+	message := strings.TrimSuffix(string(p), "\n")
+	var line []byte
+	if c.format == FormatJSON {
+		line = jsonLine(time.Now(), w.level, message, w.logger.fields)
+	} else {
+		line = textLine(time.Now(), w.level, message, w.logger.fields)
+	}
+
+	_, err := c.output.Write(line)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// textLine formats "[LEVEL] date time message key=value ..."
+func textLine(t time.Time, level Level, message string, fields []field) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "[%s] %s %s", strings.ToUpper(level.String()), t.Format("2006/01/02 15:04:05"), message)
+	for _, f := range fields {
+		value := fmt.Sprint(f.value)
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&buf, " %s=%s", f.key, value)
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// jsonLine formats one JSON object per line, with the fields after time,
+// level and msg in the order they were added
+func jsonLine(t time.Time, level Level, message string, fields []field) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	writeJSONField(&buf, "time", t.Format(time.RFC3339Nano))
+	buf.WriteByte(',')
+	writeJSONField(&buf, "level", level.String())
+	buf.WriteByte(',')
+	writeJSONField(&buf, "msg", message)
+	for _, f := range fields {
+		buf.WriteByte(',')
+		writeJSONField(&buf, f.key, f.value)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+func writeJSONField(buf *bytes.Buffer, key string, value interface{}) {
+	k, _ := json.Marshal(key)
+	buf.Write(k)
+	buf.WriteByte(':')
+
+	// Errors and durations read better as text than as their JSON encoding
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case time.Duration:
+		value = v.String()
+	}
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(v)
+}
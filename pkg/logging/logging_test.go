@@ -0,0 +1,166 @@
+// pkg/logging/logging_test.go
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Matches the date and time of a text line
+var timestampPattern = regexp.MustCompile(`\d{4}/\d\d/\d\d \d\d:\d\d:\d\d `)
+
+// lines returns the lines written to buf without their timestamps
+func lines(buf *bytes.Buffer) []string {
+	var result []string
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if line != "" {
+			result = append(result, timestampPattern.ReplaceAllString(line, ""))
+		}
+	}
+	buf.Reset()
+	return result
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Level
+	}{
+		{"debug", LevelDebug},
+		{"INFO", LevelInfo},
+		{"warn", LevelWarn},
+		{"Warning", LevelWarn},
+		{"error", LevelError},
+	}
+	for _, test := range tests {
+		got, err := ParseLevel(test.s)
+		if err != nil || got != test.want {
+			t.Errorf("ParseLevel(%q) = %s, %v, want %s", test.s, got, err, test.want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+	if got := Level(7).String(); got != "Level(7)" {
+		t.Errorf("Level(7).String() = %q", got)
+	}
+}
+
+func TestLevelFiltering(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf)
+	derived := logger.With("subproject", "a")
+
+	logAll := func(l *Logger) {
+		l.Debug.Println("debug")
+		l.Info.Println("info")
+		l.Warn.Println("warn")
+		l.Error.Println("error")
+	}
+
+	// Info by default
+	logAll(logger)
+	if got, want := strings.Join(lines(&buf), "|"), "[INFO] info|[WARN] warn|[ERROR] error"; got != want {
+		t.Errorf("default level wrote %q, want %q", got, want)
+	}
+
+	// Setting the level on either logger applies to both
+	derived.SetLevel(LevelWarn)
+	logAll(logger)
+	if got, want := strings.Join(lines(&buf), "|"), "[WARN] warn|[ERROR] error"; got != want {
+		t.Errorf("warn level wrote %q, want %q", got, want)
+	}
+	if logger.Enabled(LevelInfo) || !logger.Enabled(LevelWarn) {
+		t.Errorf("Enabled(info) = %t, Enabled(warn) = %t at warn level", logger.Enabled(LevelInfo), logger.Enabled(LevelWarn))
+	}
+
+	logger.SetLevel(LevelDebug)
+	logAll(derived)
+	if got := lines(&buf); len(got) != 4 || got[0] != "[DEBUG] debug subproject=a" {
+		t.Errorf("debug level wrote %q", got)
+	}
+}
+
+func TestTextFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf).With("run_id", "20240501-1", "subproject", "a")
+	step := logger.With("step", "unit tests", "empty", "", "quote", `say "hi"`, "duration", 1500*time.Millisecond, "odd")
+
+	step.Info.Printf("Running %s\n", "tests")
+	logger.Info.Print("Parent")
+	got := lines(&buf)
+	want := []string{
+		`[INFO] Running tests run_id=20240501-1 subproject=a step="unit tests" empty="" quote="say \"hi\"" duration=1.5s odd=(missing)`,
+		// With leaves the logger it derives from alone
+		`[INFO] Parent run_id=20240501-1 subproject=a`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("text lines:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf)
+	if err := logger.SetFormat("xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if err := logger.SetFormat(FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	logger.With("subproject", "a", "err", errors.New("exit status 1"), "timeout", time.Minute, "attempt", 2, "unencodable", make(chan int)).
+		Warn.Printf("Step \"test\" failed\nafter retrying\n")
+
+	line := buf.String()
+	if strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "}\n") {
+		t.Fatalf("want one JSON object on one line, got %q", line)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatalf("%v: %s", err, line)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, entry["time"].(string)); err != nil {
+		t.Errorf("time: %v", err)
+	}
+	for key, want := range map[string]interface{}{
+		"level":      "warn",
+		"msg":        "Step \"test\" failed\nafter retrying",
+		"subproject": "a",
+		"err":        "exit status 1",
+		"timeout":    "1m0s",
+		"attempt":    float64(2),
+	} {
+		if entry[key] != want {
+			t.Errorf("%s = %#v, want %#v", key, entry[key], want)
+		}
+	}
+	if s, ok := entry["unencodable"].(string); !ok || !strings.HasPrefix(s, "0x") {
+		t.Errorf("unencodable = %#v, want it as text", entry["unencodable"])
+	}
+
+	// time, level and msg come first, then the fields in the order added
+	order := []string{`"time"`, `"level"`, `"msg"`, `"subproject"`, `"err"`, `"timeout"`, `"attempt"`, `"unencodable"`}
+	for i := 1; i < len(order); i++ {
+		if strings.Index(line, order[i-1]) > strings.Index(line, order[i]) {
+			t.Errorf("%s comes before %s in %s", order[i], order[i-1], line)
+		}
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	var first, second bytes.Buffer
+	logger := NewLogger(&first)
+	derived := logger.With("subproject", "a")
+
+	derived.SetOutput(&second)
+	logger.Info.Println("redirected")
+	if first.Len() != 0 || !strings.Contains(second.String(), "redirected") {
+		t.Errorf("first = %q, second = %q, want the line in second", first.String(), second.String())
+	}
+}
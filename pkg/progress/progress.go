@@ -0,0 +1,87 @@
+// pkg/progress/progress.go
+package progress
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+
+	"buildy/pkg/build"
+)
+
+// IsTerminal reports whether f is an interactive terminal that understands
+// cursor movement
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0 && os.Getenv("TERM") != "dumb"
+}
+
+// Plain writes command output as it comes, one line at a time with the
+// subproject name in front so that parallel builds stay readable
+type Plain struct {
+	out     io.Writer
+	mu      sync.Mutex
+	writers map[string]*prefixWriter
+}
+
+func NewPlain(out io.Writer) *Plain {
+	return &Plain{out: out, writers: make(map[string]*prefixWriter)}
+}
+
+func (p *Plain) Output(name string) io.Writer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	w := &prefixWriter{plain: p, prefix: []byte("[" + name + "] ")}
+	p.writers[name] = w
+	return w
+}
+
+func (p *Plain) SubProjectStarted(name string)        {}
+func (p *Plain) StepStarted(name, phase, step string) {}
+
+func (p *Plain) SubProjectFinished(name string, result *build.Result) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if w, ok := p.writers[name]; ok {
+		w.flush()
+		delete(p.writers, name)
+	}
+}
+
+type prefixWriter struct {
+	plain   *Plain
+	prefix  []byte
+	partial []byte
+}
+
+func (w *prefixWriter) Write(data []byte) (int, error) {
+	w.plain.mu.Lock()
+	defer w.plain.mu.Unlock()
+
+	w.partial = append(w.partial, data...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := append(append([]byte{}, w.prefix...), w.partial[:i+1]...)
+		w.partial = w.partial[i+1:]
+		if _, err := w.plain.out.Write(line); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// flush writes a last line that didn't end in a newline. The caller holds
+// the lock.
+func (w *prefixWriter) flush() {
+	if len(w.partial) > 0 {
+		w.plain.out.Write(append(append(append([]byte{}, w.prefix...), w.partial...), '\n'))
+		w.partial = nil
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+// pkg/progress/size_unix.go
+package progress
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminalWidth returns the number of columns of the terminal f refers to
+func terminalWidth(f *os.File) (int, error) {
+	size, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ)
+	if err != nil {
+		return 0, err
+	}
+	return int(size.Col), nil
+}
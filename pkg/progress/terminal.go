@@ -0,0 +1,292 @@
+// pkg/progress/terminal.go
+package progress
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"buildy/pkg/build"
+)
+
+const (
+	refreshInterval = 100 * time.Millisecond
+	// Lines of a failed subproject's output shown at the end of the build
+	failureOutputLines = 100
+)
+
+var spinner = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// Display shows a live status line per running subproject at the bottom of
+// the terminal. Finished subprojects get a single line above it; the output
+// of successful ones is dropped and that of failed ones is shown at the end.
+type Display struct {
+	out    io.Writer
+	total  int
+	start  time.Time
+	colors bool
+
+	mu       sync.Mutex
+	running  []*task
+	finished []finishedTask
+	outputs  map[string]*bytes.Buffer
+	// Number of status lines currently drawn below the scrolling output
+	lines int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type task struct {
+	name    string
+	started time.Time
+	step    string
+}
+
+type finishedTask struct {
+	name   string
+	result *build.Result
+}
+
+// NewDisplay starts refreshing the status of a build of total subprojects
+// on out until Close is called
+func NewDisplay(out io.Writer, total int) *Display {
+	d := &Display{
+		out:     out,
+		total:   total,
+		start:   time.Now(),
+		colors:  os.Getenv("NO_COLOR") == "",
+		outputs: make(map[string]*bytes.Buffer),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.mu.Lock()
+				d.redraw()
+				d.mu.Unlock()
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+
+	return d
+}
+
+// Log returns a writer for log lines, which scroll above the status lines
+func (d *Display) Log() io.Writer {
+	return logWriter{d}
+}
+
+type logWriter struct {
+	d *Display
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w.d.mu.Lock()
+	defer w.d.mu.Unlock()
+	w.d.clear()
+	n, err := w.d.out.Write(p)
+	w.d.draw()
+	return n, err
+}
+
+func (d *Display) Output(name string) io.Writer {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	buf := &bytes.Buffer{}
+	d.outputs[name] = buf
+	return outputWriter{d, buf}
+}
+
+type outputWriter struct {
+	d   *Display
+	buf *bytes.Buffer
+}
+
+func (w outputWriter) Write(p []byte) (int, error) {
+	w.d.mu.Lock()
+	defer w.d.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (d *Display) SubProjectStarted(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.running = append(d.running, &task{name: name, started: time.Now()})
+	d.redraw()
+}
+
+func (d *Display) StepStarted(name, phase, step string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, t := range d.running {
+		if t.name == name {
+			t.step = phase + ": " + step
+		}
+	}
+	d.redraw()
+}
+
+func (d *Display) SubProjectFinished(name string, result *build.Result) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i, t := range d.running {
+		if t.name == name {
+			d.running = append(d.running[:i:i], d.running[i+1:]...)
+			break
+		}
+	}
+	d.finished = append(d.finished, finishedTask{name, result})
+	if !failed(result) {
+		delete(d.outputs, name)
+	}
+
+	d.clear()
+	line := fmt.Sprintf("%s  %s", name, result.Status)
+	if result.Duration > 0 {
+		line += "  " + result.Duration.Round(100*time.Millisecond).String()
+	}
+	if result.Err != nil {
+		line += "  " + strings.ReplaceAll(result.Err.Error(), "\n", " ")
+	}
+	fmt.Fprintf(d.out, "%s %s\n", d.symbol(result.Status), truncate(line, d.width()-2))
+	d.draw()
+}
+
+// Close stops the status lines and shows the output of failed subprojects
+func (d *Display) Close() {
+	close(d.stop)
+	<-d.done
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.clear()
+
+	for _, f := range d.finished {
+		buf, ok := d.outputs[f.name]
+		if !failed(f.result) || !ok || buf.Len() == 0 {
+			continue
+		}
+
+		fmt.Fprintf(d.out, "\n%s\n", d.color(31, fmt.Sprintf("==> Output of %s (%s)", f.name, f.result.Status)))
+		lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+		if len(lines) > failureOutputLines {
+			fmt.Fprintf(d.out, "... %d earlier lines", len(lines)-failureOutputLines)
+			if f.result.LogFile != "" {
+				fmt.Fprintf(d.out, " in %s", f.result.LogFile)
+			}
+			fmt.Fprintln(d.out)
+			lines = lines[len(lines)-failureOutputLines:]
+		}
+		fmt.Fprintln(d.out, strings.Join(lines, "\n"))
+	}
+
+	fmt.Fprintf(d.out, "%d subprojects in %s\n", len(d.finished), time.Since(d.start).Round(100*time.Millisecond))
+}
+
+// clear erases the status lines. The caller holds the lock.
+func (d *Display) clear() {
+	if d.lines > 0 {
+		// Move to the start of the first status line and erase to the end of the screen
+		fmt.Fprintf(d.out, "\x1b[%dF\x1b[J", d.lines)
+		d.lines = 0
+	}
+}
+
+// draw writes the status lines below the output. The caller holds the lock.
+func (d *Display) draw() {
+	if len(d.running) == 0 {
+		return
+	}
+
+	frame := spinner[int(time.Since(d.start)/refreshInterval)%len(spinner)]
+	columns := d.width()
+
+	var buf bytes.Buffer
+	header := fmt.Sprintf("%s Building: %d/%d done, %d running  %s", frame, len(d.finished), d.total, len(d.running), time.Since(d.start).Round(time.Second))
+	fmt.Fprintln(&buf, truncate(header, columns))
+	for _, t := range d.running {
+		step := t.step
+		if step == "" {
+			step = "starting"
+		}
+		line := fmt.Sprintf("  %s %s  %s  %s", frame, t.name, step, time.Since(t.started).Round(100*time.Millisecond))
+		fmt.Fprintln(&buf, truncate(line, columns))
+	}
+
+	d.out.Write(buf.Bytes())
+	d.lines = len(d.running) + 1
+}
+
+func (d *Display) redraw() {
+	d.clear()
+	d.draw()
+}
+
+func (d *Display) symbol(status string) string {
+	switch status {
+	case build.StatusSuccess:
+		return d.color(32, "✓")
+	case build.StatusCached:
+		return d.color(36, "○")
+	case build.StatusFailure, build.StatusTimedOut:
+		return d.color(31, "✗")
+	default:
+		return d.color(33, "-")
+	}
+}
+
+// color wraps s in an ANSI color code unless NO_COLOR is set
+func (d *Display) color(code int, s string) string {
+	if !d.colors {
+		return s
+	}
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", code, s)
+}
+
+func failed(result *build.Result) bool {
+	return result.Status != build.StatusSuccess && result.Status != build.StatusCached
+}
+
+// width is the width of the terminal the display writes to, or else
+// $COLUMNS, or 80. Status lines are cut to fit so that they never wrap,
+// which would break redrawing them.
+func (d *Display) width() int {
+	if f, ok := d.out.(*os.File); ok {
+		if columns, err := terminalWidth(f); err == nil && columns > 0 {
+			return columns
+		}
+	}
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return 80
+}
+
+// truncate cuts s to less than columns runes, ending it with an ellipsis.
+// Even on a tiny terminal the ellipsis is kept.
+func truncate(s string, columns int) string {
+	if columns < 2 {
+		columns = 2
+	}
+	if utf8.RuneCountInString(s) < columns {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:columns-2]) + "…"
+}
@@ -0,0 +1,42 @@
+// pkg/progress/terminal_test.go
+package progress
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s       string
+		columns int
+		want    string
+	}{
+		{"short", 80, "short"},
+		{"abcdef", 5, "abc…"},
+		{"äöüßé", 4, "äö…"},
+		{"abc", 2, "…"},
+		{"abc", 1, "…"},
+		{"abc", 0, "…"},
+		{"abc", -5, "…"},
+		{"", -5, ""},
+	}
+	for _, test := range tests {
+		if got := truncate(test.s, test.columns); got != test.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", test.s, test.columns, got, test.want)
+		}
+	}
+}
+
+func TestWidth(t *testing.T) {
+	d := &Display{out: &bytes.Buffer{}}
+
+	t.Setenv("COLUMNS", "42")
+	if w := d.width(); w != 42 {
+		t.Errorf("width with COLUMNS=42 = %d", w)
+	}
+	t.Setenv("COLUMNS", "")
+	if w := d.width(); w != 80 {
+		t.Errorf("width without a terminal or COLUMNS = %d, want 80", w)
+	}
+}
@@ -0,0 +1,270 @@
+// pkg/reporting/html.go
+package reporting
+
+import (
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"buildy/pkg/build"
+)
+
+// Size and spacing of dependency graph nodes, in SVG pixels
+const (
+	graphNodeWidth  = 160
+	graphNodeHeight = 36
+	graphColumnGap  = 80
+	graphRowGap     = 20
+	graphMargin     = 10
+)
+
+type htmlGraphNode struct {
+	Name   string
+	Status string
+	X, Y   int
+	// TextX and TextY center the name in the node
+	TextX, TextY int
+}
+
+type htmlGraphEdge struct {
+	X1, Y1, X2, Y2 int
+	// Failed marks edges from a dependency that didn't build
+	Failed bool
+}
+
+type htmlGraph struct {
+	Width, Height         int
+	NodeWidth, NodeHeight int
+	Nodes                 []htmlGraphNode
+	Edges                 []htmlGraphEdge
+}
+
+type htmlStatusCount struct {
+	Status string
+	Count  int
+}
+
+type htmlData struct {
+	Report  *BuildReport
+	Summary []htmlStatusCount
+	Graph   htmlGraph
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"statusClass": func(status string) string { return "status-" + strings.ToLower(status) },
+	"formatTime":  func(t time.Time) string { return t.Format(time.RFC1123) },
+	"formatBytes": formatBytes,
+}).Parse(htmlSource))
+
+// writeHTML renders a self-contained page: no scripts, stylesheets or
+// images are loaded from elsewhere, so the file can be mailed or archived.
+func writeHTML(w io.Writer, report *BuildReport) error {
+	data := htmlData{
+		Report:  report,
+		Summary: statusSummary(report),
+		Graph:   layoutGraph(report),
+	}
+	return htmlTemplate.Execute(w, data)
+}
+
+func statusSummary(report *BuildReport) []htmlStatusCount {
+	counts := make(map[string]int)
+	for _, subProject := range report.SubProjects {
+		counts[subProject.Status]++
+	}
+
+	var summary []htmlStatusCount
+	for status, count := range counts {
+		summary = append(summary, htmlStatusCount{Status: status, Count: count})
+	}
+	sort.Slice(summary, func(i, j int) bool { return summary[i].Status < summary[j].Status })
+
+	return summary
+}
+
+// layoutGraph places each subproject in a column by dependency depth, so
+// edges always run left to right from a dependency to its dependents.
+func layoutGraph(report *BuildReport) htmlGraph {
+	subProjects := make(map[string]SubProjectReport)
+	for _, subProject := range report.SubProjects {
+		subProjects[subProject.Name] = subProject
+	}
+
+	depths := make(map[string]int)
+	var depth func(name string, visiting map[string]bool) int
+	depth = func(name string, visiting map[string]bool) int {
+		if d, ok := depths[name]; ok {
+			return d
+		}
+		if visiting[name] {
+			return 0
+		}
+		visiting[name] = true
+		d := 0
+		for _, dependency := range subProjects[name].DependsOn {
+			if _, ok := subProjects[dependency]; ok {
+				if dd := depth(dependency, visiting) + 1; dd > d {
+					d = dd
+				}
+			}
+		}
+		depths[name] = d
+		return d
+	}
+
+	graph := htmlGraph{NodeWidth: graphNodeWidth, NodeHeight: graphNodeHeight}
+	positions := make(map[string]htmlGraphNode)
+	rows := make(map[int]int)
+	for _, subProject := range report.SubProjects {
+		column := depth(subProject.Name, make(map[string]bool))
+		node := htmlGraphNode{
+			Name:   subProject.Name,
+			Status: subProject.Status,
+			X:      graphMargin + column*(graphNodeWidth+graphColumnGap),
+			Y:      graphMargin + rows[column]*(graphNodeHeight+graphRowGap),
+		}
+		node.TextX, node.TextY = node.X+graphNodeWidth/2, node.Y+graphNodeHeight/2
+		rows[column]++
+		positions[subProject.Name] = node
+		graph.Nodes = append(graph.Nodes, node)
+
+		if right := node.X + graphNodeWidth + graphMargin; right > graph.Width {
+			graph.Width = right
+		}
+		if bottom := node.Y + graphNodeHeight + graphMargin; bottom > graph.Height {
+			graph.Height = bottom
+		}
+	}
+
+	for _, subProject := range report.SubProjects {
+		to := positions[subProject.Name]
+		for _, dependency := range subProject.DependsOn {
+			from, ok := positions[dependency]
+			if !ok {
+				continue
+			}
+			graph.Edges = append(graph.Edges, htmlGraphEdge{
+				X1:     from.X + graphNodeWidth,
+				Y1:     from.Y + graphNodeHeight/2,
+				X2:     to.X,
+				Y2:     to.Y + graphNodeHeight/2,
+				Failed: from.Status != build.StatusSuccess && from.Status != build.StatusCached,
+			})
+		}
+	}
+
+	return graph
+}
+
+const htmlSource = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Build Report - {{.Report.Project}} {{.Report.Version}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292f; }
+h1 { margin-bottom: 0.2em; }
+.meta { color: #57606a; margin-bottom: 1.5em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #d0d7de; padding: 6px 10px; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+.badge { display: inline-block; padding: 2px 8px; border-radius: 10px; font-size: 0.85em; font-weight: 600; }
+.status-success { background: #dafbe1; color: #116329; }
+.status-cached { background: #ddf4ff; color: #0969da; }
+.status-failure, .status-timedout { background: #ffebe9; color: #cf222e; }
+.status-cancelled, .status-skipped { background: #eaeef2; color: #57606a; }
+.error { color: #cf222e; white-space: pre-wrap; }
+pre { background: #f6f8fa; padding: 10px; overflow-x: auto; }
+details { margin-bottom: 1em; }
+summary { cursor: pointer; font-weight: 600; }
+svg text { font-size: 13px; dominant-baseline: middle; text-anchor: middle; }
+svg rect { stroke: #8c959f; stroke-width: 1; }
+svg rect.status-success { fill: #dafbe1; }
+svg rect.status-cached { fill: #ddf4ff; }
+svg rect.status-failure, svg rect.status-timedout { fill: #ffebe9; stroke: #cf222e; stroke-width: 2; }
+svg rect.status-cancelled, svg rect.status-skipped { fill: #eaeef2; }
+svg line { stroke: #8c959f; stroke-width: 1.5; marker-end: url(#arrow); }
+svg line.failed { stroke: #cf222e; stroke-dasharray: 4 3; }
+</style>
+</head>
+<body>
+<h1>{{.Report.Project}} {{.Report.Version}}</h1>
+<div class="meta">
+  Built {{formatTime .Report.Timestamp}} in {{.Report.Duration}}{{if .Report.Profile}} with profile <strong>{{.Report.Profile}}</strong>{{end}}
+  &mdash; {{range $i, $s := .Summary}}{{if $i}}, {{end}}<span class="badge {{statusClass $s.Status}}">{{$s.Count}} {{$s.Status}}</span>{{end}}
+  {{if .Report.CriticalPath}}<br>Critical path: {{range $i, $name := .Report.CriticalPath}}{{if $i}} &rarr; {{end}}{{$name}}{{end}} ({{.Report.CriticalPathDuration}}){{end}}
+</div>
+
+<h2>Summary</h2>
+<table>
+  <tr><th>Subproject</th><th>Status</th><th>Version</th><th>Duration</th><th>CPU</th><th>Peak RSS</th><th>Error</th></tr>
+  {{range .Report.SubProjects}}
+  <tr>
+    <td><a href="#{{.Name}}">{{.Name}}</a></td>
+    <td><span class="badge {{statusClass .Status}}">{{.Status}}</span></td>
+    <td>{{if .PreviousVersion}}{{.PreviousVersion}} &rarr; <strong>{{.Version}}</strong>{{else}}{{.Version}}{{end}}</td>
+    <td>{{.Duration}}</td>
+    <td>{{.CPUTime}}</td>
+    <td>{{if .MaxRSS}}{{formatBytes .MaxRSS}}{{end}}</td>
+    <td class="error">{{.Error}}</td>
+  </tr>
+  {{end}}
+</table>
+
+<h2>Dependency Graph</h2>
+<svg xmlns="http://www.w3.org/2000/svg" width="{{.Graph.Width}}" height="{{.Graph.Height}}">
+  <defs>
+    <marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto">
+      <path d="M 0 0 L 10 5 L 0 10 z" fill="#8c959f"/>
+    </marker>
+  </defs>
+  {{range .Graph.Edges}}<line x1="{{.X1}}" y1="{{.Y1}}" x2="{{.X2}}" y2="{{.Y2}}"{{if .Failed}} class="failed"{{end}}/>
+  {{end}}
+  {{range .Graph.Nodes}}<g>
+    <title>{{.Name}}: {{.Status}}</title>
+    <rect class="{{statusClass .Status}}" x="{{.X}}" y="{{.Y}}" rx="6" width="{{$.Graph.NodeWidth}}" height="{{$.Graph.NodeHeight}}"/>
+    <text x="{{.TextX}}" y="{{.TextY}}">{{.Name}}</text>
+  </g>
+  {{end}}
+</svg>
+
+<h2>Subprojects</h2>
+{{range .Report.SubProjects}}
+<details id="{{.Name}}"{{if .Error}} open{{end}}>
+  <summary>{{.Name}} <span class="badge {{statusClass .Status}}">{{.Status}}</span></summary>
+  {{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+  {{if .Steps}}
+  <table>
+    <tr><th>Phase</th><th>Step</th><th>Status</th><th>Duration</th><th>Exit code</th><th>CPU</th><th>Peak RSS</th><th>Command</th></tr>
+    {{range .Steps}}
+    <tr>
+      <td>{{.Phase}}</td>
+      <td>{{.Name}}</td>
+      <td><span class="badge {{statusClass .Status}}">{{.Status}}</span>{{if .Error}}<div class="error">{{.Error}}</div>{{end}}</td>
+      <td>{{.Duration}}{{if gt .Attempts 1}} ({{.Attempts}} attempts){{end}}</td>
+      <td>{{if .ExitCode}}{{.ExitCode}}{{end}}</td>
+      <td>{{.CPUTime}}</td>
+      <td>{{if .MaxRSS}}{{formatBytes .MaxRSS}}{{end}}</td>
+      <td><code>{{.Command}}</code></td>
+    </tr>
+    {{end}}
+  </table>
+  {{end}}
+  {{if .Artifacts}}
+  <table>
+    <tr><th>Artifact</th><th>Size</th><th>SHA-256</th></tr>
+    {{range .Artifacts}}<tr><td>{{.Path}}</td><td>{{.Size}} bytes</td><td><code>{{.SHA256}}</code></td></tr>
+    {{end}}
+  </table>
+  {{end}}
+  {{if .LogTail}}<h4>Log <small><code>{{.LogFile}}</code></small></h4>
+  <pre>{{.LogTail}}</pre>{{end}}
+  {{if .Changelog}}<h4>Changelog</h4>
+  <pre>{{.Changelog}}</pre>{{end}}
+</details>
+{{end}}
+</body>
+</html>
+`
@@ -0,0 +1,39 @@
+// pkg/reporting/html_test.go
+package reporting
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLayoutGraph(t *testing.T) {
+	report := &BuildReport{SubProjects: []SubProjectReport{
+		{Name: "lib", Status: "Success"},
+		{Name: "app", Status: "Failure", DependsOn: []string{"lib"}},
+	}}
+	graph := layoutGraph(report)
+
+	if graph.NodeWidth != graphNodeWidth || graph.NodeHeight != graphNodeHeight {
+		t.Errorf("node size = %dx%d, want %dx%d", graph.NodeWidth, graph.NodeHeight, graphNodeWidth, graphNodeHeight)
+	}
+	lib, app := graph.Nodes[0], graph.Nodes[1]
+	if app.X <= lib.X {
+		t.Errorf("app at x=%d, want it right of its dependency at x=%d", app.X, lib.X)
+	}
+	if lib.TextX != lib.X+graphNodeWidth/2 || lib.TextY != lib.Y+graphNodeHeight/2 {
+		t.Errorf("text at %d,%d, want the center of the node at %d,%d", lib.TextX, lib.TextY, lib.X, lib.Y)
+	}
+	if len(graph.Edges) != 1 || graph.Edges[0].X1 != lib.X+graphNodeWidth || graph.Edges[0].X2 != app.X {
+		t.Errorf("edges = %+v", graph.Edges)
+	}
+
+	var html strings.Builder
+	if err := writeHTML(&html, report); err != nil {
+		t.Fatal(err)
+	}
+	size := fmt.Sprintf(`width="%d" height="%d"`, graphNodeWidth, graphNodeHeight)
+	if strings.Count(html.String(), size) != 2 {
+		t.Errorf("HTML report doesn't size both nodes with %s", size)
+	}
+}
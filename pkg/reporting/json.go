@@ -0,0 +1,14 @@
+// pkg/reporting/json.go
+package reporting
+
+import (
+	"encoding/json"
+	"io"
+)
+
+func writeJSON(w io.Writer, report *BuildReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(report)
+}
@@ -0,0 +1,145 @@
+// pkg/reporting/junit.go
+package reporting
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"buildy/pkg/build"
+)
+
+// JUnit XML as understood by most CI systems: one suite per subproject and
+// one test case per step, or a single case for subprojects without steps
+// (cached, skipped or failed before any step ran).
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+func writeJUnit(w io.Writer, report *BuildReport) error {
+	suites := junitTestSuites{
+		Name: fmt.Sprintf("%s %s", report.Project, report.Version),
+		Time: junitSeconds(report.Duration),
+	}
+
+	for _, subProject := range report.SubProjects {
+		suite := junitTestSuite{
+			Name:      subProject.Name,
+			Time:      junitSeconds(subProject.Duration),
+			Timestamp: report.Timestamp.Format(time.RFC3339),
+		}
+
+		if len(subProject.Steps) == 0 {
+			suite.Cases = append(suite.Cases, junitCase(subProject.Name, subProject.Name, "", subProject.Status, subProject.Error, subProject.Duration))
+		}
+		for _, step := range subProject.Steps {
+			suite.Cases = append(suite.Cases, junitCase(subProject.Name, step.Phase+": "+step.Name, step.Command, step.Status, step.Error, step.Duration))
+		}
+
+		// The log tail goes with the case that failed the subproject
+		if subProject.LogTail != "" {
+			for i := range suite.Cases {
+				if message := suite.Cases[i].Failure; message != nil && message.Text == subProject.Error {
+					message.Text += "\n\n" + subProject.LogTail
+					break
+				}
+				if message := suite.Cases[i].Error; message != nil && message.Text == subProject.Error {
+					message.Text += "\n\n" + subProject.LogTail
+					break
+				}
+			}
+		}
+
+		for _, c := range suite.Cases {
+			suite.Tests++
+			switch {
+			case c.Failure != nil:
+				suite.Failures++
+			case c.Error != nil:
+				suite.Errors++
+			case c.Skipped != nil:
+				suite.Skipped++
+			}
+		}
+
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Errors += suite.Errors
+		suites.Skipped += suite.Skipped
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(suites)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// junitCase maps a buildy status onto JUnit: failures and timeouts are
+// failures, cancellation is an error, and cached or skipped work is skipped.
+func junitCase(className, name, command, status, message string, duration Duration) junitTestCase {
+	c := junitTestCase{
+		Name:      name,
+		ClassName: className,
+		Time:      junitSeconds(duration),
+		SystemOut: command,
+	}
+
+	switch status {
+	case build.StatusFailure, build.StatusTimedOut:
+		c.Failure = &junitMessage{Message: message, Type: status, Text: message}
+	case build.StatusCancelled:
+		c.Error = &junitMessage{Message: message, Type: status, Text: message}
+	case build.StatusSkipped, build.StatusCached:
+		c.Skipped = &junitMessage{Message: status}
+	}
+
+	return c
+}
+
+func junitSeconds(d Duration) string {
+	return fmt.Sprintf("%.3f", time.Duration(d).Seconds())
+}
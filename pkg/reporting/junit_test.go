@@ -0,0 +1,112 @@
+// pkg/reporting/junit_test.go
+package reporting
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"buildy/pkg/build"
+)
+
+func junitReport() *BuildReport {
+	step := func(phase, name, status, err string) StepReport {
+		return StepReport{Phase: phase, Name: name, Command: "make " + name, Status: status, Error: err, Duration: Duration(1500 * time.Millisecond)}
+	}
+	return &BuildReport{
+		Timestamp: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		Project:   "platform",
+		Version:   "1.2.0",
+		Duration:  Duration(12 * time.Second),
+		SubProjects: []SubProjectReport{
+			{Name: "lib", Status: build.StatusSuccess, Duration: Duration(3 * time.Second), Steps: []StepReport{
+				step("build", "compile", build.StatusSuccess, ""),
+				step("test", "unit", build.StatusSuccess, ""),
+			}},
+			{Name: "app", Status: build.StatusFailure, Error: "step \"unit\" failed: exit status 1", LogTail: "FAIL TestApp", Steps: []StepReport{
+				step("build", "compile", build.StatusSuccess, ""),
+				step("test", "unit", build.StatusFailure, "step \"unit\" failed: exit status 1"),
+				step("test", "e2e", build.StatusSkipped, ""),
+			}},
+			{Name: "api", Status: build.StatusTimedOut, Error: "step \"compile\" failed: command timed out after 1m0s", Steps: []StepReport{
+				step("build", "compile", build.StatusTimedOut, "step \"compile\" failed: command timed out after 1m0s"),
+			}},
+			{Name: "worker", Status: build.StatusCancelled, Error: "build cancelled before start"},
+			{Name: "docs", Status: build.StatusCached},
+			{Name: "cli", Status: build.StatusSkipped, Error: "dependency app Failure"},
+		},
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeJUnit(&buf, junitReport()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), xml.Header) {
+		t.Errorf("missing XML header:\n%s", buf.String())
+	}
+
+	var suites junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatalf("%v:\n%s", err, buf.String())
+	}
+	if suites.Name != "platform 1.2.0" || suites.Time != "12.000" {
+		t.Errorf("testsuites name = %q, time = %s", suites.Name, suites.Time)
+	}
+	if suites.Tests != 9 || suites.Failures != 2 || suites.Errors != 1 || suites.Skipped != 3 {
+		t.Errorf("testsuites counts tests=%d failures=%d errors=%d skipped=%d, want 9, 2, 1, 3",
+			suites.Tests, suites.Failures, suites.Errors, suites.Skipped)
+	}
+
+	// Cases per subproject, and their failures, errors and skipped ones
+	want := map[string][4]int{
+		"lib":    {2, 0, 0, 0},
+		"app":    {3, 1, 0, 1},
+		"api":    {1, 1, 0, 0},
+		"worker": {1, 0, 1, 0},
+		"docs":   {1, 0, 0, 1},
+		"cli":    {1, 0, 0, 1},
+	}
+	if len(suites.Suites) != len(want) {
+		t.Fatalf("%d suites, want %d", len(suites.Suites), len(want))
+	}
+	for _, suite := range suites.Suites {
+		got := [4]int{suite.Tests, suite.Failures, suite.Errors, suite.Skipped}
+		if got != want[suite.Name] || len(suite.Cases) != suite.Tests {
+			t.Errorf("suite %s: tests, failures, errors, skipped = %v with %d cases, want %v", suite.Name, got, len(suite.Cases), want[suite.Name])
+		}
+		if suite.Timestamp != "2024-05-01T10:00:00Z" {
+			t.Errorf("suite %s timestamp = %s", suite.Name, suite.Timestamp)
+		}
+	}
+
+	app := suites.Suites[1]
+	names := []string{app.Cases[0].Name, app.Cases[1].Name, app.Cases[2].Name}
+	if strings.Join(names, ",") != "build: compile,test: unit,test: e2e" || app.Cases[1].ClassName != "app" {
+		t.Errorf("app cases = %q, class %q", names, app.Cases[1].ClassName)
+	}
+	unit := app.Cases[1]
+	if unit.Time != "1.500" || unit.SystemOut != "make unit" {
+		t.Errorf("unit case time = %s, output %q", unit.Time, unit.SystemOut)
+	}
+	// The log tail goes with the failure of the subproject
+	if unit.Failure == nil || unit.Failure.Type != build.StatusFailure || unit.Failure.Text != "step \"unit\" failed: exit status 1\n\nFAIL TestApp" {
+		t.Errorf("unit failure = %+v", unit.Failure)
+	}
+
+	api := suites.Suites[2].Cases[0]
+	if api.Failure == nil || api.Failure.Type != build.StatusTimedOut {
+		t.Errorf("timed out case = %+v, want a TimedOut failure", api.Failure)
+	}
+	worker := suites.Suites[3].Cases[0]
+	if worker.Name != "worker" || worker.Error == nil || worker.Error.Message != "build cancelled before start" {
+		t.Errorf("cancelled case = %s %+v, want an error", worker.Name, worker.Error)
+	}
+	docs := suites.Suites[4].Cases[0]
+	if docs.Skipped == nil || docs.Skipped.Message != build.StatusCached {
+		t.Errorf("cached case skipped = %+v", docs.Skipped)
+	}
+}
@@ -0,0 +1,101 @@
+// pkg/reporting/metrics.go
+package reporting
+
+import (
+	"fmt"
+	"time"
+)
+
+// addTimings sets the overall start, end and wall duration of the build
+// from its subprojects, and finds the critical path.
+func addTimings(report *BuildReport) {
+	for _, subProject := range report.SubProjects {
+		if subProject.StartTime != nil && (report.StartTime == nil || subProject.StartTime.Before(*report.StartTime)) {
+			report.StartTime = subProject.StartTime
+		}
+		if subProject.EndTime != nil && (report.EndTime == nil || subProject.EndTime.After(*report.EndTime)) {
+			report.EndTime = subProject.EndTime
+		}
+	}
+	if report.StartTime != nil && report.EndTime != nil {
+		report.Duration = Duration(report.EndTime.Sub(*report.StartTime))
+	}
+
+	report.CriticalPath, report.CriticalPathDuration = criticalPath(report.SubProjects)
+}
+
+// criticalPath returns the dependency chain whose durations add up to the
+// most, from the first dependency to the last dependent.
+func criticalPath(subProjects []SubProjectReport) ([]string, Duration) {
+	byName := make(map[string]SubProjectReport)
+	for _, subProject := range subProjects {
+		byName[subProject.Name] = subProject
+	}
+
+	// finish[name] is the longest chain ending at name, via[name] its predecessor
+	finish := make(map[string]Duration)
+	via := make(map[string]string)
+	visiting := make(map[string]bool)
+
+	var longest func(name string) Duration
+	longest = func(name string) Duration {
+		if d, ok := finish[name]; ok {
+			return d
+		}
+		if visiting[name] {
+			return 0
+		}
+		visiting[name] = true
+
+		var best Duration
+		for _, dependency := range byName[name].DependsOn {
+			if _, ok := byName[dependency]; !ok {
+				continue
+			}
+			if d := longest(dependency); d > best || via[name] == "" {
+				best, via[name] = d, dependency
+			}
+		}
+		finish[name] = best + byName[name].Duration
+		return finish[name]
+	}
+
+	var end string
+	var total Duration
+	for _, subProject := range subProjects {
+		if d := longest(subProject.Name); d > total {
+			end, total = subProject.Name, d
+		}
+	}
+	if end == "" {
+		return nil, 0
+	}
+
+	var path []string
+	seen := make(map[string]bool)
+	for name := end; name != "" && !seen[name]; name = via[name] {
+		seen[name] = true
+		path = append([]string{name}, path...)
+	}
+	return path, total
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,61 @@
+// pkg/reporting/metrics_test.go
+package reporting
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func timed(name string, seconds int, dependsOn ...string) SubProjectReport {
+	return SubProjectReport{Name: name, Duration: Duration(time.Duration(seconds) * time.Second), DependsOn: dependsOn}
+}
+
+func TestCriticalPath(t *testing.T) {
+	tests := []struct {
+		name        string
+		subProjects []SubProjectReport
+		path        []string
+		seconds     int
+	}{
+		{"empty", nil, nil, 0},
+		{"nothing took time", []SubProjectReport{timed("a", 0)}, nil, 0},
+		{"single", []SubProjectReport{timed("a", 3)}, []string{"a"}, 3},
+		{"chain", []SubProjectReport{timed("c", 1, "b"), timed("b", 2, "a"), timed("a", 3)}, []string{"a", "b", "c"}, 6},
+		{"longest of independents", []SubProjectReport{timed("a", 2), timed("b", 5), timed("c", 1)}, []string{"b"}, 5},
+		{"diamond takes the slower branch", []SubProjectReport{
+			timed("base", 1), timed("fast", 1, "base"), timed("slow", 4, "base"), timed("app", 2, "fast", "slow"),
+		}, []string{"base", "slow", "app"}, 7},
+		{"one long project beats a chain", []SubProjectReport{
+			timed("lib", 1), timed("app", 1, "lib"), timed("docs", 5),
+		}, []string{"docs"}, 5},
+		{"skipped dependency", []SubProjectReport{timed("lib", 0), timed("app", 2, "lib")}, []string{"lib", "app"}, 2},
+		{"unknown dependency", []SubProjectReport{timed("app", 2, "missing")}, []string{"app"}, 2},
+		{"cycle", []SubProjectReport{timed("a", 1, "b"), timed("b", 2, "a")}, []string{"b", "a"}, 3},
+	}
+	for _, test := range tests {
+		path, total := criticalPath(test.subProjects)
+		want := Duration(time.Duration(test.seconds) * time.Second)
+		if !reflect.DeepEqual(path, test.path) || total != want {
+			t.Errorf("%s: criticalPath = %q, %s, want %q, %s", test.name, path, total, test.path, want)
+		}
+	}
+}
+
+func TestAddTimings(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	lib, app := timed("lib", 2), timed("app", 3, "lib")
+	lib.StartTime, lib.EndTime = timePtr(start), timePtr(start.Add(2*time.Second))
+	app.StartTime, app.EndTime = timePtr(start.Add(2*time.Second)), timePtr(start.Add(5*time.Second))
+	// Cached, so it has no times
+	docs := timed("docs", 0)
+	report := &BuildReport{SubProjects: []SubProjectReport{app, docs, lib}}
+
+	addTimings(report)
+	if !report.StartTime.Equal(start) || !report.EndTime.Equal(start.Add(5*time.Second)) || report.Duration != Duration(5*time.Second) {
+		t.Errorf("build ran %s to %s (%s), want 10:00:00 to 10:00:05 (5s)", report.StartTime, report.EndTime, report.Duration)
+	}
+	if want := []string{"lib", "app"}; !reflect.DeepEqual(report.CriticalPath, want) || report.CriticalPathDuration != Duration(5*time.Second) {
+		t.Errorf("critical path = %q (%s), want %q (5s)", report.CriticalPath, report.CriticalPathDuration, want)
+	}
+}
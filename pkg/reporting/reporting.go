@@ -2,74 +2,311 @@
 package reporting
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
+	"buildy/pkg/build"
 	"buildy/pkg/config"
 )
 
 type BuildReport struct {
-	Timestamp   time.Time
-	SubProjects []SubProjectReport
+	Timestamp time.Time `json:"timestamp"`
+	Project   string    `json:"project"`
+	Version   string    `json:"version"`
+	Profile   string    `json:"profile,omitempty"`
+	// RunID names the directory of this build's logs
+	RunID       string             `json:"runId,omitempty"`
+	StartTime   *time.Time         `json:"startTime,omitempty"`
+	EndTime     *time.Time         `json:"endTime,omitempty"`
+	Duration    Duration           `json:"durationSeconds"`
+	SubProjects []SubProjectReport `json:"subProjects"`
+
+	// CriticalPath is the chain of dependent subprojects with the longest
+	// total duration, which bounds the build time however much runs in parallel
+	CriticalPath         []string `json:"criticalPath,omitempty"`
+	CriticalPathDuration Duration `json:"criticalPathSeconds"`
 }
 
 type SubProjectReport struct {
-	Name    string
-	Version string
-	Status  string
-	Error   string
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// PreviousVersion is set when this build moved the subproject to Version
+	PreviousVersion string           `json:"previousVersion,omitempty"`
+	DependsOn       []string         `json:"dependsOn,omitempty"`
+	Status          string           `json:"status"`
+	Error           string           `json:"error,omitempty"`
+	StartTime       *time.Time       `json:"startTime,omitempty"`
+	EndTime         *time.Time       `json:"endTime,omitempty"`
+	Duration        Duration         `json:"durationSeconds"`
+	CPUTime         Duration         `json:"cpuSeconds"`
+	MaxRSS          int64            `json:"maxRssBytes"`
+	Steps           []StepReport     `json:"steps,omitempty"`
+	Artifacts       []ArtifactReport `json:"artifacts,omitempty"`
+	// LogFile holds the output of the subproject's commands, and LogTail
+	// its last lines when the build failed
+	LogFile string `json:"logFile,omitempty"`
+	LogTail string `json:"logTail,omitempty"`
+	// Changelog is the entry added to the subproject's changelog by this build
+	Changelog string `json:"changelog,omitempty"`
+}
+
+type ArtifactReport struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type StepReport struct {
+	Name      string     `json:"name"`
+	Phase     string     `json:"phase"`
+	Command   string     `json:"command"`
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	StartTime *time.Time `json:"startTime,omitempty"`
+	EndTime   *time.Time `json:"endTime,omitempty"`
+	Duration  Duration   `json:"durationSeconds"`
+	Attempts  int        `json:"attempts"`
+	// ExitCode is nil for steps that didn't run
+	ExitCode *int     `json:"exitCode,omitempty"`
+	CPUTime  Duration `json:"cpuSeconds"`
+	MaxRSS   int64    `json:"maxRssBytes"`
+}
+
+// Duration is a time.Duration written to JSON as fractional seconds
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).Round(time.Millisecond).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).Seconds())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err != nil {
+		return err
+	}
+	*d = Duration(seconds * float64(time.Second))
+	return nil
+}
+
+// Report writers by --report-format name, and the extension of their files
+var writers = map[string]func(io.Writer, *BuildReport) error{
+	"text":  writeText,
+	"json":  writeJSON,
+	"junit": writeJUnit,
+	"html":  writeHTML,
+}
+
+var extensions = map[string]string{
+	"text":  "txt",
+	"json":  "json",
+	"junit": "xml",
+	"html":  "html",
+}
+
+// Formats lists the supported report formats
+func Formats() []string {
+	formats := make([]string, 0, len(writers))
+	for format := range writers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+func ValidateFormats(formats []string) error {
+	for _, format := range formats {
+		if _, ok := writers[format]; !ok {
+			return fmt.Errorf("unknown report format %q (expected one of %s)", format, strings.Join(Formats(), ", "))
+		}
+	}
+	return nil
 }
 
-func GenerateBuildReport(cfg *config.Config, buildResults map[string]error) (*BuildReport, error) {
+// GenerateBuildReport summarizes the build results. Changelogs holds the
+// changelog entries written by this run by subproject name, and may be nil.
+func GenerateBuildReport(cfg *config.Config, buildResults map[string]*build.Result, changelogs map[string]string) (*BuildReport, error) {
 	report := &BuildReport{
 		Timestamp:   time.Now(),
+		Project:     cfg.Name,
+		Version:     cfg.Version,
+		Profile:     cfg.Profile,
 		SubProjects: make([]SubProjectReport, len(cfg.SubProjects)),
 	}
 
 	for i, subProject := range cfg.SubProjects {
 		report.SubProjects[i] = SubProjectReport{
-			Name:    subProject.Name,
-			Version: subProject.Version,
-			Status:  "Success",
-			Error:   "",
+			Name:      subProject.Name,
+			Version:   subProject.Version,
+			DependsOn: subProject.DependsOn,
+			Status:    build.StatusSuccess,
+			Error:     "",
+			Changelog: strings.TrimSpace(changelogs[subProject.Name]),
 		}
 
-		if err, ok := buildResults[subProject.Name]; ok && err != nil {
-			report.SubProjects[i].Status = "Failure"
-			report.SubProjects[i].Error = err.Error()
+		if result, ok := buildResults[subProject.Name]; ok {
+			// The version built, which the subproject moved to if it was
+			// released
+			if result.Version != "" {
+				report.SubProjects[i].Version = result.Version
+				if result.Version == subProject.Version {
+					report.SubProjects[i].PreviousVersion = result.PreviousVersion
+				}
+			}
+			report.SubProjects[i].Status = result.Status
+			report.SubProjects[i].StartTime = timePtr(result.StartTime)
+			report.SubProjects[i].EndTime = timePtr(result.EndTime)
+			report.SubProjects[i].Duration = Duration(result.Duration)
+			report.SubProjects[i].CPUTime = Duration(result.CPUTime)
+			report.SubProjects[i].MaxRSS = result.MaxRSS
+			report.SubProjects[i].LogFile = result.LogFile
+			report.SubProjects[i].LogTail = result.LogTail
+			if result.Err != nil {
+				report.SubProjects[i].Error = result.Err.Error()
+			}
+			for _, step := range result.Steps {
+				stepReport := StepReport{
+					Name:      step.Name,
+					Phase:     step.Phase,
+					Command:   step.Command,
+					Status:    step.Status,
+					StartTime: timePtr(step.StartTime),
+					EndTime:   timePtr(step.EndTime),
+					Duration:  Duration(step.Duration),
+					Attempts:  step.Attempts,
+					CPUTime:   Duration(step.CPUTime),
+					MaxRSS:    step.MaxRSS,
+				}
+				if step.Err != nil {
+					stepReport.Error = step.Err.Error()
+				}
+				if step.Attempts > 0 {
+					exitCode := step.ExitCode
+					stepReport.ExitCode = &exitCode
+				}
+				report.SubProjects[i].Steps = append(report.SubProjects[i].Steps, stepReport)
+			}
+			for _, artifact := range result.Artifacts {
+				report.SubProjects[i].Artifacts = append(report.SubProjects[i].Artifacts, ArtifactReport{
+					Path:   artifact.Path,
+					Size:   artifact.Size,
+					SHA256: artifact.SHA256,
+				})
+			}
 		}
 	}
 
+	addTimings(report)
+
 	return report, nil
 }
 
-func SaveBuildReport(report *BuildReport, outputDir string) error {
-	err := os.MkdirAll(outputDir, os.ModePerm)
+// SaveBuildReport writes the report to build_report_<timestamp>.<ext> in
+// outputDir once for each of the given formats.
+func SaveBuildReport(report *BuildReport, outputDir string, formats []string) error {
+	err := ValidateFormats(formats)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(outputDir, os.ModePerm)
 	if err != nil {
 		return fmt.Errorf("error creating output directory: %v", err)
 	}
 
 	timestamp := report.Timestamp.Format("20060102150405")
-	filename := fmt.Sprintf("build_report_%s.txt", timestamp)
-	filePath := filepath.Join(outputDir, filename)
+	for _, format := range formats {
+		write := writers[format]
 
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("error creating report file: %v", err)
+		filename := fmt.Sprintf("build_report_%s.%s", timestamp, extensions[format])
+		filePath := filepath.Join(outputDir, filename)
+
+		file, err := os.Create(filePath)
+		if err != nil {
+			return fmt.Errorf("error creating report file: %v", err)
+		}
+
+		err = write(file, report)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("error writing %s report: %v", format, err)
+		}
 	}
-	defer file.Close()
 
-	fmt.Fprintf(file, "Build Report - %s\n\n", report.Timestamp.Format(time.RFC3339))
+	return nil
+}
+
+func writeText(w io.Writer, report *BuildReport) error {
+	fmt.Fprintf(w, "Build Report - %s\n", report.Timestamp.Format(time.RFC3339))
+	if report.RunID != "" {
+		fmt.Fprintf(w, "Run: %s\n", report.RunID)
+	}
+	fmt.Fprintf(w, "Duration: %s\n", report.Duration)
+	if len(report.CriticalPath) > 0 {
+		fmt.Fprintf(w, "Critical path: %s (%s)\n", strings.Join(report.CriticalPath, " -> "), report.CriticalPathDuration)
+	}
+	fmt.Fprintln(w)
 	for _, subProject := range report.SubProjects {
-		fmt.Fprintf(file, "Subproject: %s\n", subProject.Name)
-		fmt.Fprintf(file, "Version: %s\n", subProject.Version)
-		fmt.Fprintf(file, "Status: %s\n", subProject.Status)
+		fmt.Fprintf(w, "Subproject: %s\n", subProject.Name)
+		if subProject.PreviousVersion != "" {
+			fmt.Fprintf(w, "Version: %s -> %s\n", subProject.PreviousVersion, subProject.Version)
+		} else {
+			fmt.Fprintf(w, "Version: %s\n", subProject.Version)
+		}
+		fmt.Fprintf(w, "Status: %s\n", subProject.Status)
+		fmt.Fprintf(w, "Duration: %s\n", subProject.Duration)
+		if subProject.CPUTime > 0 || subProject.MaxRSS > 0 {
+			fmt.Fprintf(w, "CPU time: %s, peak RSS: %s\n", subProject.CPUTime, formatBytes(subProject.MaxRSS))
+		}
 		if subProject.Error != "" {
-			fmt.Fprintf(file, "Error: %s\n", subProject.Error)
+			fmt.Fprintf(w, "Error: %s\n", subProject.Error)
+		}
+		if subProject.LogFile != "" {
+			fmt.Fprintf(w, "Log: %s\n", subProject.LogFile)
+		}
+		if subProject.LogTail != "" {
+			fmt.Fprintln(w, "Log tail:")
+			for _, line := range strings.Split(subProject.LogTail, "\n") {
+				fmt.Fprintf(w, "  | %s\n", line)
+			}
+		}
+		if len(subProject.Steps) > 0 {
+			fmt.Fprintln(w, "Steps:")
+			for _, step := range subProject.Steps {
+				fmt.Fprintf(w, "  [%s] %s: %s (%s", step.Phase, step.Name, step.Status, step.Duration)
+				if step.ExitCode != nil {
+					fmt.Fprintf(w, ", exit code %d", *step.ExitCode)
+				}
+				if step.Attempts > 1 {
+					fmt.Fprintf(w, ", %d attempts", step.Attempts)
+				}
+				fmt.Fprintln(w, ")")
+				if step.Error != "" {
+					fmt.Fprintf(w, "    Error: %s\n", step.Error)
+				}
+			}
+		}
+		if len(subProject.Artifacts) > 0 {
+			fmt.Fprintln(w, "Artifacts:")
+			for _, artifact := range subProject.Artifacts {
+				fmt.Fprintf(w, "  %s (%d bytes)\n    sha256: %s\n", artifact.Path, artifact.Size, artifact.SHA256)
+			}
+		}
+		_, err := fmt.Fprintln(w)
+		if err != nil {
+			return err
 		}
-		fmt.Fprintln(file)
 	}
 
 	return nil